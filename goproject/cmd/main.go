@@ -4,13 +4,27 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"goproject/internal/authent"
+	"goproject/internal/events"
+	"goproject/internal/export"
 	"goproject/internal/friendship"
+	"goproject/internal/leaderboard"
 	"goproject/internal/match"
 	"goproject/internal/middleware"
+	"goproject/internal/notification"
+	"goproject/internal/rating"
+	"goproject/internal/scoring"
+	"goproject/internal/season"
 	"goproject/internal/simulation"
+	"goproject/internal/storage"
 	"goproject/internal/user"
+	"goproject/internal/webhook"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -22,19 +36,183 @@ func main() {
 
 	ctx := context.Background()
 
+	// Elo K katsayısı ortam değişkeniyle değiştirilebilir
+	if k, err := strconv.ParseFloat(os.Getenv("ELO_K_FACTOR"), 64); err == nil && k > 0 {
+		rating.KFactor = k
+	}
+
+	// Oyun sunucuları maç sonucunu bu anahtarla bildirebilir
+	authent.ServiceKey = os.Getenv("SERVICE_API_KEY")
+
+	// Tekrarlanan maç bildirimlerinin tanındığı süre
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_WINDOW")); err == nil && d > 0 {
+		match.IdempotencyWindow = d
+	}
+
+	// Oyuncu bildirimlerinin rakip onayı beklemesi isteğe bağlıdır
+	match.RequireConfirmation = os.Getenv("MATCH_CONFIRMATION") == "required"
+
+	// Ek puanlama kuralları bir JSON dosyasından yüklenebilir, varsayılan kural seti adla seçilir
+	if path := os.Getenv("SCORING_RULES_FILE"); path != "" {
+		if err := scoring.LoadFile(path); err != nil {
+			log.Fatalf("Scoring rules could not be loaded: %v", err)
+		}
+	}
+	if name := os.Getenv("SCORING_RULES"); name != "" {
+		if _, err := scoring.Get(name); err != nil {
+			log.Fatalf("Scoring rules %s: %v", name, err)
+		}
+		scoring.Default = name
+	}
+
+	// Sezon süresi verilirse sezonlar otomatik kapanır; SEASON_CARRY puanların taşınan oranı
+	if d, err := time.ParseDuration(os.Getenv("SEASON_LENGTH")); err == nil && d > 0 {
+		season.Length = d
+	}
+	if c, err := strconv.ParseFloat(os.Getenv("SEASON_CARRY"), 64); err == nil && c >= 0 && c <= 1 {
+		season.Carry = c
+	}
+
+	// Eşit puanlılar için sıra numarası biçimi ve virgülle ayrılmış eşitlik bozucular
+	if mode := os.Getenv("LEADERBOARD_RANKING"); leaderboard.ValidMode(mode) {
+		leaderboard.RankingMode = mode
+	}
+	if list := os.Getenv("LEADERBOARD_TIEBREAKERS"); list != "" {
+		tiebreakers := []string{}
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if !leaderboard.ValidTiebreaker(name) {
+				log.Fatalf("Unknown leaderboard tiebreaker %s", name)
+			}
+			tiebreakers = append(tiebreakers, name)
+		}
+		leaderboard.Tiebreakers = tiebreakers
+	}
+
+	// Sıralamalarda gösterilen profillerin önbellek süresi; 0 önbelleği kapatır
+	if d, err := time.ParseDuration(os.Getenv("PROFILE_CACHE_TTL")); err == nil && d >= 0 {
+		user.ProfileCacheTTL = d
+	}
+
+	// Sıralama sayfası önbelleğinin boyutu ve süresi; ikisinden biri 0 ise önbellek kapanır
+	pageCacheSize, pageCacheTTL := 1000, 10*time.Second
+	if n, err := strconv.Atoi(os.Getenv("LEADERBOARD_CACHE_SIZE")); err == nil && n >= 0 {
+		pageCacheSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LEADERBOARD_CACHE_TTL")); err == nil && d >= 0 {
+		pageCacheTTL = d
+	}
+	leaderboard.Pages = leaderboard.NewPageCache(pageCacheSize, pageCacheTTL)
+
+	// Canlı sıralama abonelerine gönderilen güncellemelerin birleştirildiği aralık
+	if d, err := time.ParseDuration(os.Getenv("LIVE_UPDATE_INTERVAL")); err == nil && d > 0 {
+		match.LiveUpdateInterval = d
+	}
+
+	// Avatar gibi dosyalar yerel diskte tutulur ve /uploads/ altından sunulur
+	blobStore, err := storage.NewLocalStore("uploads", "/uploads/")
+	if err != nil {
+		log.Fatalf("Blob store failed: %v", err)
+	}
+
+	// Dışa aktarma arşivleri kişisel veri içerir; ayrı bir dizinde tutulur ve yalnızca
+	// kısa ömürlü indirme bağlantısıyla sunulur
+	exportStore, err := storage.NewLocalStore("exports", "")
+	if err != nil {
+		log.Fatalf("Export store failed: %v", err)
+	}
+	// Önceki sürümler arşivleri herkese açık yükleme dizinine yazıyordu
+	if err := os.RemoveAll(filepath.Join(blobStore.Root, "exports")); err != nil {
+		log.Printf("Old export archives could not be removed: %v", err)
+	}
+
 	http.HandleFunc("/register", middleware.AuthMiddleware(rdb, ctx, "RegisterHandler", user.RegisterHandler(rdb, ctx)))
 	http.HandleFunc("/login", middleware.AuthMiddleware(rdb, ctx, "LoginHandler", user.LoginHandler(rdb, ctx)))
 	http.HandleFunc("/update", middleware.AuthMiddleware(rdb, ctx, "UpdateHandler", user.UpdateInfoHandler(rdb, ctx)))
 	http.HandleFunc("/matchresult", middleware.AuthMiddleware(rdb, ctx, "MatchResultHandler", match.MatchResultHandler(rdb, ctx)))
 	http.HandleFunc("/leaderboard", middleware.AuthMiddleware(rdb, ctx, "LeaderboardHandler", match.LeaderboardHandler(rdb, ctx)))
+	http.HandleFunc("/leaderboard/me", middleware.AuthMiddleware(rdb, ctx, "MyRankHandler", match.MyRankHandler(rdb, ctx)))
+	http.HandleFunc("/leaderboard/friends", middleware.AuthMiddleware(rdb, ctx, "FriendsLeaderboardHandler", match.FriendsLeaderboardHandler(rdb, ctx)))
+	http.HandleFunc("/leaderboard/table", middleware.AuthMiddleware(rdb, ctx, "LeagueTableHandler", match.LeagueTableHandler(rdb, ctx)))
+	http.HandleFunc("/match", middleware.AuthMiddleware(rdb, ctx, "MatchHandler", match.MatchHandler(rdb, ctx)))
+	http.HandleFunc("/matches/history", middleware.AuthMiddleware(rdb, ctx, "MatchHistoryHandler", match.MatchHistoryHandler(rdb, ctx)))
+	http.HandleFunc("/notifications/stream", middleware.AuthMiddleware(rdb, ctx, "NotificationStreamHandler", notification.StreamHandler(rdb, ctx)))
+	http.HandleFunc("/stream/ticket", middleware.AuthMiddleware(rdb, ctx, "StreamTicketHandler", user.StreamTicketHandler(rdb, ctx)))
+	http.HandleFunc("/leaderboard/live", middleware.AuthMiddleware(rdb, ctx, "LiveLeaderboardHandler", match.LiveLeaderboardHandler(rdb, ctx)))
+	http.HandleFunc("/leaderboard/cache", middleware.AuthMiddleware(rdb, ctx, "LeaderboardCacheStatsHandler", match.LeaderboardCacheStatsHandler(rdb, ctx)))
+	http.HandleFunc("/webhooks", middleware.AuthMiddleware(rdb, ctx, "WebhooksHandler", webhook.WebhooksHandler(rdb, ctx)))
+	http.HandleFunc("/webhooks/create", middleware.AuthMiddleware(rdb, ctx, "CreateWebhookHandler", webhook.CreateWebhookHandler(rdb, ctx)))
+	http.HandleFunc("/webhooks/delete", middleware.AuthMiddleware(rdb, ctx, "DeleteWebhookHandler", webhook.DeleteWebhookHandler(rdb, ctx)))
+	http.HandleFunc("/webhooks/deliveries", middleware.AuthMiddleware(rdb, ctx, "WebhookDeliveriesHandler", webhook.DeliveriesHandler(rdb, ctx)))
+	http.HandleFunc("/webhooks/replay", middleware.AuthMiddleware(rdb, ctx, "ReplayWebhookHandler", webhook.ReplayHandler(rdb, ctx)))
+	http.HandleFunc("/matches/headtohead", middleware.AuthMiddleware(rdb, ctx, "HeadToHeadHandler", match.HeadToHeadHandler(rdb, ctx)))
+	http.HandleFunc("/matches/pending", middleware.AuthMiddleware(rdb, ctx, "PendingMatchesHandler", match.PendingMatchesHandler(rdb, ctx)))
+	http.HandleFunc("/matches/confirm", middleware.AuthMiddleware(rdb, ctx, "ConfirmMatchHandler", match.ConfirmMatchHandler(rdb, ctx)))
+	http.HandleFunc("/matches/disputes", middleware.AuthMiddleware(rdb, ctx, "DisputesHandler", match.DisputesHandler(rdb, ctx)))
+	http.HandleFunc("/matches/resolve", middleware.AuthMiddleware(rdb, ctx, "ResolveDisputeHandler", match.ResolveDisputeHandler(rdb, ctx)))
+	http.HandleFunc("/rating", middleware.AuthMiddleware(rdb, ctx, "RatingHandler", rating.RatingHandler(rdb, ctx)))
+	http.HandleFunc("/rating/leaderboard", middleware.AuthMiddleware(rdb, ctx, "RatingLeaderboardHandler", rating.RatingLeaderboardHandler(rdb, ctx)))
+	http.HandleFunc("/rating/history", middleware.AuthMiddleware(rdb, ctx, "RatingHistoryHandler", rating.RatingHistoryHandler(rdb, ctx)))
+	http.HandleFunc("/scoring/rules", middleware.AuthMiddleware(rdb, ctx, "RuleSetsHandler", scoring.RuleSetsHandler(rdb, ctx)))
+	http.HandleFunc("/scoring/league", middleware.AuthMiddleware(rdb, ctx, "LeagueRulesHandler", scoring.LeagueRulesHandler(rdb, ctx)))
+	http.HandleFunc("/seasons", middleware.AuthMiddleware(rdb, ctx, "SeasonsHandler", season.SeasonsHandler(rdb, ctx)))
+	http.HandleFunc("/seasons/rollover", middleware.AuthMiddleware(rdb, ctx, "RolloverHandler", season.RolloverHandler(rdb, ctx)))
 	http.HandleFunc("/userdetails", middleware.AuthMiddleware(rdb, ctx, "UserDetailsHandler", user.UserDetailsHandler(rdb, ctx)))
 	http.HandleFunc("/simulation", middleware.AuthMiddleware(rdb, ctx, "SimulationHandler", simulation.SimulationHandler(rdb, ctx)))
+	http.HandleFunc("/avatar", middleware.AuthMiddleware(rdb, ctx, "AvatarUploadHandler", user.AvatarUploadHandler(rdb, ctx, blobStore)))
+	http.HandleFunc("/users/me", middleware.AuthMiddleware(rdb, ctx, "DeleteAccountHandler", user.DeleteAccountHandler(rdb, ctx)))
+	http.HandleFunc("/export", middleware.AuthMiddleware(rdb, ctx, "ExportRequestHandler", export.ExportRequestHandler(rdb, ctx, exportStore)))
+	http.HandleFunc("/export/status", middleware.AuthMiddleware(rdb, ctx, "ExportStatusHandler", export.ExportStatusHandler(rdb, ctx)))
+	http.HandleFunc("/export/download", export.ExportDownloadHandler(rdb, ctx, exportStore))
+	http.Handle("/uploads/", http.StripPrefix("/uploads/", blobStore.Handler()))
+	http.HandleFunc("/users/batch", middleware.AuthMiddleware(rdb, ctx, "BulkUserLookupHandler", user.BulkUserLookupHandler(rdb, ctx)))
+	http.HandleFunc("/users/search", middleware.AuthMiddleware(rdb, ctx, "SearchUsersHandler", friendship.SearchUsersHandler(rdb, ctx)))
 	http.HandleFunc("/friendship/search", friendship.UserSearchHandler(rdb, ctx))
 	http.HandleFunc("/friendship/friendrequest", friendship.FriendRequestHandler(rdb, ctx))
 	http.HandleFunc("/friendship/friendrequestlist", friendship.FriendRequestListHandler(rdb, ctx))
 	http.HandleFunc("/friendship/respondrequest", friendship.AcceptRejectFriendRequestHandler(rdb, ctx))
 	http.HandleFunc("/friendship/friendlist", friendship.FriendListHandler(rdb, ctx))
 
+	// İlk açılışta eski sıralama ilk sezona taşınır
+	if err := season.Init(rdb, ctx); err != nil {
+		log.Fatalf("Season init failed: %v", err)
+	}
+
+	// Farklı skor kümelerinden önce yazılmış sıralamalar için kümeleri bir kez kur
+	if err := leaderboard.RebuildDistinctScores(rdb, ctx); err != nil {
+		log.Printf("Distinct score rebuild failed: %v", err)
+	}
+
+	// Arama indeksinden önce kaydedilmiş kullanıcıları indeksle
+	if err := user.RebuildUsernameIndex(rdb, ctx); err != nil {
+		log.Printf("Username index rebuild failed: %v", err)
+	}
+
+	// İkili karşılaşma indeksinden önce kaydedilmiş maçları bir kez indeksle
+	if err := match.RebuildHeadToHeadIndex(rdb, ctx); err != nil {
+		log.Printf("Head-to-head index rebuild failed: %v", err)
+	}
+
+	// Süresi dolan silme işlemlerini arka planda tamamla
+	user.StartPurgeWorker(rdb, ctx, time.Minute)
+	export.StartCleanupWorker(rdb, ctx, exportStore, time.Minute)
+	export.StartBuildWorkers(rdb, ctx)
+	match.StartConfirmationWorker(rdb, ctx, time.Minute)
+	season.StartSeasonWorker(rdb, ctx, time.Minute)
+	match.StartLiveUpdates(rdb, ctx)
+	notification.StartStreams(rdb, ctx)
+	webhook.StartDeliveryWorker(rdb, ctx, 5*time.Second)
+
+	// Yan etkiler olay akışına abone olan işleyicilerle yürütülür
+	match.RegisterEventHandlers(rdb)
+	notification.RegisterEventHandlers(rdb)
+	user.RegisterEventHandlers(blobStore)
+	export.RegisterEventHandlers(rdb, exportStore)
+	webhook.RegisterEventHandlers(rdb)
+	if err := events.Start(rdb, ctx); err != nil {
+		log.Fatalf("Event bus failed: %v", err)
+	}
+
 	// Start the HTTP server
 	server := &http.Server{
 		Addr:         ":8080",
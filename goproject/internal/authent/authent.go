@@ -2,6 +2,7 @@ package authent
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"masomointern/internal/constants"
 	"net/http"
@@ -13,6 +14,18 @@ import (
 	"github.com/google/uuid"
 )
 
+// ServiceKey, oyun sunucusu gibi servislerin kimlik bilgisi; boşsa servis erişimi kapalıdır
+var ServiceKey string
+
+// TicketTTL, akış bağlantıları için verilen tek kullanımlık biletin geçerlilik süresi
+var TicketTTL = 30 * time.Second
+
+// IsServiceRequest reports whether the request carries the service credential in the X-Service-Key header
+func IsServiceRequest(r *http.Request) bool {
+	key := r.Header.Get("X-Service-Key")
+	return ServiceKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(ServiceKey)) == 1
+}
+
 func GenerateToken(rdb *redis.Client, ctx context.Context, userID int) (string, error) {
 	token := uuid.New().String()
 	key := fmt.Sprintf(constants.TokenPrefix+"%s", token)
@@ -20,9 +33,36 @@ func GenerateToken(rdb *redis.Client, ctx context.Context, userID int) (string,
 	if err != nil {
 		return "", err
 	}
+
+	// Kullanıcının tüm token'larını topluca iptal edebilmek için indeksliyoruz
+	tokensKey := constants.UserTokensPrefix + strconv.Itoa(userID)
+	err = rdb.SAdd(ctx, tokensKey, token).Err()
+	if err != nil {
+		return "", err
+	}
+	err = rdb.Expire(ctx, tokensKey, 24*time.Hour).Err()
+	if err != nil {
+		return "", err
+	}
 	return token, nil
 }
 
+// RevokeUserTokens deletes every token issued to the user
+func RevokeUserTokens(rdb *redis.Client, ctx context.Context, userID int) error {
+	tokensKey := constants.UserTokensPrefix + strconv.Itoa(userID)
+	tokens, err := rdb.SMembers(ctx, tokensKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		keys = append(keys, constants.TokenPrefix+token)
+	}
+	keys = append(keys, tokensKey)
+	return rdb.Del(ctx, keys...).Err()
+}
+
 func GetUserIDFromToken(rdb *redis.Client, ctx context.Context, r *http.Request) (int, error) {
 	token := r.Header.Get("Authorization")
 	if token == "" {
@@ -51,6 +91,46 @@ func GetUserIDFromToken(rdb *redis.Client, ctx context.Context, r *http.Request)
 	return userID, nil
 }
 
+// GenerateStreamTicket issues a single-use ticket for opening a WebSocket or event stream.
+// Browsers cannot set the Authorization header on those connections, so the ticket is sent
+// as the ticket query parameter instead of the long-lived token.
+func GenerateStreamTicket(rdb *redis.Client, ctx context.Context, userID int) (string, error) {
+	ticket := uuid.New().String()
+	err := rdb.Set(ctx, constants.StreamTicketPrefix+ticket, userID, TicketTTL).Err()
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// GetStreamUserID authenticates a streaming request with the ticket query parameter, or with
+// the Authorization header when no ticket is given. A ticket can be used only once.
+func GetStreamUserID(rdb *redis.Client, ctx context.Context, r *http.Request) (int, error) {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		return GetUserIDFromToken(rdb, ctx, r)
+	}
+
+	key := constants.StreamTicketPrefix + ticket
+	var get *redis.StringCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return 0, fmt.Errorf("Invalid or expired ticket")
+	} else if err != nil {
+		return 0, err
+	}
+
+	userID, err := strconv.Atoi(get.Val())
+	if err != nil {
+		return 0, fmt.Errorf("Invalid user ID in ticket")
+	}
+	return userID, nil
+}
+
 func TestGenerateAndGetToken(t *testing.T) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: "localhost:6379",
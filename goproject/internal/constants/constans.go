@@ -1,13 +1,64 @@
 package constants
 
 const (
-	UserPrefix          = "user:"
-	UsernamePrefix      = "username:"
-	NextUserID          = "next_user_id"
-	Leaderboard         = "leaderboard"
-	TokenPrefix         = "token:"
-	UserIDKey           = "user_id"
-	FriendRequestPrefix = "friendrequest:"
-	FriendPrefix        = "friends:"
-	FriendListPrefix    = "friendlist:"
+	UserPrefix              = "user:"
+	UsernamePrefix          = "username:"
+	NextUserID              = "next_user_id"
+	Leaderboard             = "leaderboard"
+	TokenPrefix             = "token:"
+	UserIDKey               = "user_id"
+	FriendRequestPrefix     = "friendrequest:"
+	FriendPrefix            = "friends:"
+	FriendListPrefix        = "friendlist:"
+	UserTokensPrefix        = "usertokens:"
+	StreamTicketPrefix      = "streamticket:"
+	SentRequestPrefix       = "sentfriendrequest:"
+	DeletionQueue           = "deletion_queue"
+	ExportJobPrefix         = "export:"
+	ExportLinkPrefix        = "exportlink:"
+	UserExportPrefix        = "userexport:"
+	ExportArchives          = "export_archives"
+	ExportPendingPrefix     = "exportpending:"
+	UsernameIndex           = "username_index"
+	UsernameGramPrefix      = "usernamegram:"
+	FuzzySearchPrefix       = "fuzzysearch:"
+	UsernameIndexBuilt      = "username_index_built"
+	MatchPrefix             = "match:"
+	NextMatchID             = "next_match_id"
+	UserMatchesPrefix       = "usermatches:"
+	RatingPrefix            = "rating:"
+	RatingHistoryPrefix     = "ratinghistory:"
+	RatingLeaderboardPrefix = "rating_leaderboard:"
+	IdempotencyPrefix       = "idempotency:"
+	PendingMatchPrefix      = "pendingmatch:"
+	PendingDeadlines        = "pending_match_deadlines"
+	UserPendingPrefix       = "userpending:"
+	DisputeQueue            = "dispute_queue"
+	LeagueRules             = "league_rules"
+	CurrentSeason           = "current_season"
+	SeasonPrefix            = "season:"
+	SeasonLeaderboardPrefix = "leaderboard:season:"
+	PeriodLeaderboardPrefix = "leaderboard:"
+	FriendsBoardPrefix      = "friendsboard:"
+	StatsPrefix             = "stats:"
+	TablePrefix             = "table:"
+	HeadToHeadPrefix        = "h2h:"
+	OpponentsPrefix         = "h2hopponents:"
+	HeadToHeadIndexBuilt    = "h2h_index_built"
+	BoardVersionSuffix      = ":version" // Her sıralamanın kendi sürüm sayacı
+	BoardScoresSuffix       = ":scores"  // Sıralamadaki farklı skorlar
+	BoardScoreCountsSuffix  = ":scorecounts"
+	DistinctScoresBuilt     = "distinct_scores_built"
+	LeaderboardUpdates      = "leaderboard_updates" // Pub/Sub kanalı
+	NotificationPrefix      = "notifications:"
+	NotificationWakeups     = "notification_wakeups" // Pub/Sub kanalı
+	EventStream             = "events"
+	DeadLetterStream        = "events:dead"
+	EventErrors             = "events:errors"
+	WebhookPrefix           = "webhook:"
+	Webhooks                = "webhooks"
+	NextWebhookID           = "next_webhook_id"
+	WebhookDeliveryPrefix   = "webhookdelivery:"
+	WebhookDeliveriesPrefix = "webhookdeliveries:"
+	WebhookQueue            = "webhook_queue"
 )
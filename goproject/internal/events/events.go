@@ -0,0 +1,339 @@
+// Package events is a publish/subscribe bus for domain events persisted in a Redis Stream.
+// Every subscription is a consumer group, so each subscriber sees every event once while the
+// server instances share its work. Delivery is at least once: an event whose handler fails is
+// retried with exponential backoff and moved to the dead-letter stream after MaxDeliveries.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Olay türleri
+const (
+	UserRegistered        = "user.registered"
+	MatchReported         = "match.reported"
+	FriendRequestSent     = "friend_request.sent"
+	FriendRequestAccepted = "friend_request.accepted"
+	UserPurged            = "user.purged"
+)
+
+// Types lists every event type that is published
+var Types = []string{UserRegistered, MatchReported, FriendRequestSent, FriendRequestAccepted, UserPurged}
+
+var (
+	// StreamLength, olay akışında yaklaşık olarak tutulan en fazla olay
+	StreamLength int64 = 100000
+
+	// MaxDeliveries, bir olayın ölü mektup akışına taşınmadan önce en fazla kaç kez işleneceği
+	MaxDeliveries int64 = 5
+
+	// RetryDelay, başarısız olayın ilk yeniden denemesinden önce beklenen süre; her denemede iki katına çıkar
+	RetryDelay = 10 * time.Second
+
+	// ClaimInterval, bekleyen olayların yeniden deneme için kontrol edilme aralığı
+	ClaimInterval = 5 * time.Second
+
+	readBlock = 5 * time.Second
+	readCount = int64(20)
+)
+
+// Event, akıştan okunan bir olay
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt string          `json:"occurred_at"`
+}
+
+// Decode unmarshals the event payload
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Olay verileri
+
+type UserRegisteredData struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type UserPurgedData struct {
+	UserID int `json:"user_id"`
+}
+
+type FriendRequestData struct {
+	FromUserID   int    `json:"from_user_id"`
+	FromUsername string `json:"from_username"`
+	ToUserID     int    `json:"to_user_id"`
+	ToUsername   string `json:"to_username"`
+}
+
+type MatchPlayer struct {
+	UserID    int     `json:"user_id"`
+	Team      string  `json:"team,omitempty"`
+	Score     int     `json:"score"`
+	Placement int     `json:"placement"`
+	Points    int     `json:"points"`
+	EloChange float64 `json:"elo_change"`
+}
+
+type MatchReportedData struct {
+	MatchID int           `json:"match_id"`
+	Format  string        `json:"format"`
+	League  string        `json:"league,omitempty"`
+	Season  int           `json:"season"`
+	Players []MatchPlayer `json:"players"`
+
+	// RanksBefore, oyuncuların maçtan önceki sezon sıraları; sıralamada olmayanlar listelenmez
+	RanksBefore map[int]int `json:"ranks_before,omitempty"`
+}
+
+// Handler processes an event; a returned error leaves the event pending for a retry
+type Handler func(ctx context.Context, e Event) error
+
+type subscription struct {
+	group   string
+	types   map[string]bool
+	handler Handler
+}
+
+var (
+	subscriptionsMu sync.Mutex
+	subscriptions   []subscription
+)
+
+// Subscribe registers handler for the given event types under a consumer group name. Groups
+// must be unique and are started by Start.
+func Subscribe(group string, handler Handler, types ...string) {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	subscriptions = append(subscriptions, subscription{group: group, types: set, handler: handler})
+}
+
+// Publish appends an event to the stream
+func Publish(rdb *redis.Client, ctx context.Context, eventType string, data interface{}) error {
+	return QueuePublish(rdb, ctx, eventType, data)
+}
+
+// QueuePublish appends an event to the stream through c. Given a transaction pipeline, the
+// event is only published if the transaction commits, together with the writes it describes.
+func QueuePublish(c redis.Cmdable, ctx context.Context, eventType string, data interface{}) error {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.XAdd(ctx, &redis.XAddArgs{
+		Stream: constants.EventStream,
+		MaxLen: StreamLength,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":        eventType,
+			"data":        dataJSON,
+			"occurred_at": time.Now().Format(time.RFC3339),
+		},
+	}).Err()
+}
+
+func parseEvent(msg redis.XMessage) Event {
+	e := Event{ID: msg.ID}
+	e.Type, _ = msg.Values["type"].(string)
+	data, _ := msg.Values["data"].(string)
+	e.Data = json.RawMessage(data)
+	e.OccurredAt, _ = msg.Values["occurred_at"].(string)
+	return e
+}
+
+// consumerName, bu sunucuyu tüketici grubunda ayırt eden ad
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "server"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Start creates the consumer groups of every subscription and starts consuming. New groups
+// begin with events published after their creation.
+func Start(rdb *redis.Client, ctx context.Context) error {
+	subscriptionsMu.Lock()
+	subs := append([]subscription{}, subscriptions...)
+	subscriptionsMu.Unlock()
+
+	consumer := consumerName()
+	for _, sub := range subs {
+		err := rdb.XGroupCreateMkStream(ctx, constants.EventStream, sub.group, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+		go sub.consume(rdb, ctx, consumer)
+		go sub.retry(rdb, ctx, consumer)
+	}
+	return nil
+}
+
+// errorField, başarısız bir olayın son hatasının EventErrors hash'indeki alanı
+func (s subscription) errorField(id string) string {
+	return s.group + ":" + id
+}
+
+// handle runs the handler for an event and acknowledges it on success. Events of other types
+// are acknowledged right away.
+func (s subscription) handle(rdb *redis.Client, ctx context.Context, e Event) {
+	if s.types[e.Type] {
+		if err := s.handler(ctx, e); err != nil {
+			log.Printf("Event %s (%s) failed in %s: %v", e.ID, e.Type, s.group, err)
+			rdb.HSet(ctx, constants.EventErrors, s.errorField(e.ID), err.Error())
+			return
+		}
+	}
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, constants.EventStream, s.group, e.ID)
+		pipe.HDel(ctx, constants.EventErrors, s.errorField(e.ID))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Event %s could not be acknowledged in %s: %v", e.ID, s.group, err)
+	}
+}
+
+// consume reads new events for the group until ctx is cancelled
+func (s subscription) consume(rdb *redis.Client, ctx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: consumer,
+			Streams:  []string{constants.EventStream, ">"},
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			log.Printf("Event stream read failed in %s: %v", s.group, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				s.handle(rdb, ctx, parseEvent(msg))
+			}
+		}
+	}
+}
+
+// backoff, deliveries kez teslim edilmiş olayın yeniden denenmesi için gereken bekleme
+func backoff(deliveries int64) time.Duration {
+	delay := RetryDelay
+	for i := int64(1); i < deliveries && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// retry periodically claims events whose handler failed, retrying them after their backoff and
+// moving them to the dead-letter stream once MaxDeliveries is reached
+func (s subscription) retry(rdb *redis.Client, ctx context.Context, consumer string) {
+	ticker := time.NewTicker(ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: constants.EventStream,
+			Group:  s.group,
+			Idle:   RetryDelay,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			log.Printf("Pending events could not be read in %s: %v", s.group, err)
+			continue
+		}
+
+		for _, p := range pending {
+			if p.Idle < backoff(p.RetryCount) {
+				continue
+			}
+
+			// XCLAIM teslim sayısını artırır; başka bir sunucu aynı olayı önce aldıysa boş döner
+			claimed, err := rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   constants.EventStream,
+				Group:    s.group,
+				Consumer: consumer,
+				MinIdle:  backoff(p.RetryCount),
+				Messages: []string{p.ID},
+			}).Result()
+			if err != nil {
+				log.Printf("Event %s could not be claimed in %s: %v", p.ID, s.group, err)
+				continue
+			}
+			for _, msg := range claimed {
+				if msg.Values == nil {
+					// Akıştan kırpılmış olay artık işlenemez
+					rdb.XAck(ctx, constants.EventStream, s.group, msg.ID)
+					continue
+				}
+				if p.RetryCount >= MaxDeliveries {
+					s.deadLetter(rdb, ctx, msg, p.RetryCount)
+					continue
+				}
+				s.handle(rdb, ctx, parseEvent(msg))
+			}
+		}
+	}
+}
+
+// deadLetter copies an event that kept failing to the dead-letter stream and acknowledges it
+func (s subscription) deadLetter(rdb *redis.Client, ctx context.Context, msg redis.XMessage, deliveries int64) {
+	lastError, err := rdb.HGet(ctx, constants.EventErrors, s.errorField(msg.ID)).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Event %s error could not be read: %v", msg.ID, err)
+		return
+	}
+
+	values := map[string]interface{}{
+		"event_id":   msg.ID,
+		"group":      s.group,
+		"deliveries": deliveries,
+		"error":      lastError,
+	}
+	for field, value := range msg.Values {
+		values[field] = value
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: constants.DeadLetterStream, MaxLen: StreamLength, Approx: true, Values: values})
+		pipe.XAck(ctx, constants.EventStream, s.group, msg.ID)
+		pipe.HDel(ctx, constants.EventErrors, s.errorField(msg.ID))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Event %s could not be moved to the dead-letter stream: %v", msg.ID, err)
+		return
+	}
+	log.Printf("Event %s moved to the dead-letter stream after %d deliveries in %s", msg.ID, deliveries, s.group)
+}
@@ -0,0 +1,500 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/events"
+	"masomointern/internal/match"
+	"masomointern/internal/season"
+	"masomointern/internal/storage"
+	"masomointern/internal/table"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+var (
+	JobTTL  = 24 * time.Hour   // Dışa aktarma işinin ve arşivin saklanma süresi
+	LinkTTL = 15 * time.Minute // İndirme bağlantısının geçerlilik süresi
+
+	// BuildWorkers, aynı anda hazırlanan en fazla arşiv; MaxQueuedBuilds, sırada bekleyebilecek iş
+	BuildWorkers    = 2
+	MaxQueuedBuilds = 100
+
+	// BuildTimeout, bir kullanıcının hazırlanan işinin yeni istekleri bu işe yönlendirdiği en uzun süre
+	BuildTimeout = 10 * time.Minute
+)
+
+// builds, hazırlanmayı bekleyen işler; StartBuildWorkers tarafından oluşturulur
+var builds chan buildRequest
+
+type buildRequest struct {
+	store storage.BlobStore
+	job   Job
+}
+
+// releaseScript, kullanıcının bekleyen iş işaretini yalnızca hâlâ bu işe aitse siler
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type Response struct {
+	Status  bool        `json:"status"`
+	Result  interface{} `json:"result"`
+	Message string      `json:"message"`
+}
+
+// Job, asenkron hazırlanan bir veri dışa aktarma işi
+type Job struct {
+	ID        string `json:"id"`
+	UserID    int    `json:"user_id"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Session struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+type Friend struct {
+	UserID string `json:"user_id"`
+	Since  string `json:"since"`
+}
+
+type PendingRequest struct {
+	UserID string `json:"user_id"`
+	Date   string `json:"date"`
+}
+
+type Standing struct {
+	Season int     `json:"season"`
+	Rank   int64   `json:"rank"`
+	Score  float64 `json:"score"`
+}
+
+// blobKey, arşivin dışa aktarma deposundaki anahtarı. Depo herkese açık sunulmamalı;
+// arşivlere yalnızca ExportDownloadHandler üzerinden erişilir.
+func blobKey(jobID string) string {
+	return jobID + ".zip"
+}
+
+// deleteArchive removes an archive and its expiry entry
+func deleteArchive(rdb *redis.Client, ctx context.Context, store storage.BlobStore, jobID string) error {
+	if err := store.Delete(blobKey(jobID)); err != nil {
+		return err
+	}
+	return rdb.ZRem(ctx, constants.ExportArchives, jobID).Err()
+}
+
+func saveJob(rdb *redis.Client, ctx context.Context, job Job) error {
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, constants.ExportJobPrefix+job.ID, jobJSON, JobTTL).Err()
+}
+
+func getJob(rdb *redis.Client, ctx context.Context, jobID string) (Job, error) {
+	jobJSON, err := rdb.Get(ctx, constants.ExportJobPrefix+jobID).Result()
+	if err == redis.Nil {
+		return Job{}, errors.New("Export not found")
+	} else if err != nil {
+		return Job{}, err
+	}
+
+	var job Job
+	err = json.Unmarshal([]byte(jobJSON), &job)
+	return job, err
+}
+
+// ExportRequestHandler queues an archive of the caller's data and returns the job. A user has
+// at most one export in preparation; asking again returns that job.
+func ExportRequestHandler(rdb *redis.Client, ctx context.Context, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		job := Job{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			Status:    StatusPending,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		}
+		pendingKey := constants.ExportPendingPrefix + strconv.Itoa(userID)
+		claimed, err := rdb.SetNX(ctx, pendingKey, job.ID, BuildTimeout).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			// Hazırlanmakta olan iş varsa yenisi başlatılmaz, aynı iş döndürülür
+			pendingID, err := rdb.Get(ctx, pendingKey).Result()
+			if err == nil {
+				if pending, err := getJob(rdb, ctx, pendingID); err == nil {
+					json.NewEncoder(w).Encode(Response{Status: true, Result: pending, Message: "An export is already being prepared"})
+					return
+				}
+			}
+			http.Error(w, "An export is already being prepared", http.StatusConflict)
+			return
+		}
+
+		err = saveJob(rdb, ctx, job)
+		if err != nil {
+			releaseScript.Run(ctx, rdb, []string{pendingKey}, job.ID)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Arşiv sınırlı sayıda işçi tarafından hazırlanır, istemci durum uç noktasını sorgular
+		select {
+		case builds <- buildRequest{store: store, job: job}:
+		default:
+			rdb.Del(ctx, constants.ExportJobPrefix+job.ID)
+			releaseScript.Run(ctx, rdb, []string{pendingKey}, job.ID)
+			http.Error(w, "Too many exports are being prepared, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: job})
+	}
+}
+
+// StartBuildWorkers starts BuildWorkers goroutines preparing queued archives
+func StartBuildWorkers(rdb *redis.Client, ctx context.Context) {
+	builds = make(chan buildRequest, MaxQueuedBuilds)
+	for i := 0; i < BuildWorkers; i++ {
+		go func() {
+			for request := range builds {
+				buildArchive(rdb, ctx, request.store, request.job)
+			}
+		}()
+	}
+}
+
+// ExportStatusHandler reports the state of an export and issues a short-lived download link once it is ready
+func ExportStatusHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		job, err := getJob(rdb, ctx, r.URL.Query().Get("id"))
+		if err != nil || job.UserID != userID {
+			http.Error(w, "Export not found", http.StatusNotFound)
+			return
+		}
+
+		result := map[string]interface{}{"job": job}
+		if job.Status == StatusReady {
+			linkToken := uuid.New().String()
+			err = rdb.Set(ctx, constants.ExportLinkPrefix+linkToken, job.ID, LinkTTL).Err()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result["download_url"] = "/export/download?token=" + linkToken
+			result["expires_at"] = time.Now().Add(LinkTTL).Format(time.RFC3339)
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: result})
+	}
+}
+
+// ExportDownloadHandler serves the archive for a download link; the link token is the credential
+func ExportDownloadHandler(rdb *redis.Client, ctx context.Context, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		jobID, err := rdb.Get(ctx, constants.ExportLinkPrefix+r.URL.Query().Get("token")).Result()
+		if err == redis.Nil {
+			http.Error(w, "Invalid or expired download link", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := store.Get(blobKey(jobID))
+		if err == storage.ErrNotFound {
+			http.Error(w, "Export not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="export-`+jobID+`.zip"`)
+		w.Write(data)
+	}
+}
+
+func buildArchive(rdb *redis.Client, ctx context.Context, store storage.BlobStore, job Job) {
+	data, err := collect(rdb, ctx, job.UserID)
+	if err == nil {
+		err = store.Put(blobKey(job.ID), data)
+	}
+
+	if err == nil {
+		// Arşiv, iş kaydıyla birlikte JobTTL sonunda temizleme işçisi tarafından silinir
+		err = rdb.ZAdd(ctx, constants.ExportArchives, &redis.Z{Score: float64(time.Now().Add(JobTTL).Unix()), Member: job.ID}).Err()
+	}
+
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID, err)
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		store.Delete(blobKey(job.ID))
+	} else {
+		job.Status = StatusReady
+	}
+
+	err = saveJob(rdb, ctx, job)
+	if err != nil {
+		log.Printf("Export %s: saving job: %v", job.ID, err)
+	}
+	// Kullanıcı artık yeni bir dışa aktarma isteyebilir
+	releaseScript.Run(ctx, rdb, []string{constants.ExportPendingPrefix + strconv.Itoa(job.UserID)}, job.ID)
+	if job.Status != StatusReady {
+		return
+	}
+
+	// Kullanıcının bir önceki arşivini siliyoruz, diskte tek kopya kalsın
+	lastKey := constants.UserExportPrefix + strconv.Itoa(job.UserID)
+	previous, err := rdb.GetSet(ctx, lastKey, job.ID).Result()
+	if err == nil && previous != job.ID {
+		deleteArchive(rdb, ctx, store, previous)
+	}
+	rdb.Expire(ctx, lastKey, JobTTL)
+}
+
+// RegisterEventHandlers subscribes the export package to the events it reacts to
+func RegisterEventHandlers(rdb *redis.Client, store storage.BlobStore) {
+	// Silinen kullanıcının dışa aktarma arşivi
+	events.Subscribe("exports", func(ctx context.Context, e events.Event) error {
+		var data events.UserPurgedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+
+		lastKey := constants.UserExportPrefix + strconv.Itoa(data.UserID)
+		jobID, err := rdb.Get(ctx, lastKey).Result()
+		if err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := deleteArchive(rdb, ctx, store, jobID); err != nil {
+			return err
+		}
+		return rdb.Del(ctx, lastKey).Err()
+	}, events.UserPurged)
+}
+
+// StartCleanupWorker periodically deletes archives whose job has expired
+func StartCleanupWorker(rdb *redis.Client, ctx context.Context, store storage.BlobStore, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			due, err := rdb.ZRangeByScore(ctx, constants.ExportArchives, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().Unix(), 10),
+			}).Result()
+			if err != nil {
+				log.Printf("Export cleanup: %v", err)
+				continue
+			}
+
+			for _, jobID := range due {
+				if err := deleteArchive(rdb, ctx, store, jobID); err != nil {
+					log.Printf("Export cleanup: %s: %v", jobID, err)
+				}
+			}
+		}
+	}()
+}
+
+// collect gathers the user's data into a zip archive with one JSON file per section
+func collect(rdb *redis.Client, ctx context.Context, userID int) ([]byte, error) {
+	id := strconv.Itoa(userID)
+
+	profile, err := user.GetUserByID(rdb, ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile.Password = ""
+
+	sessions, err := collectSessions(rdb, ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	friendsZ, err := rdb.ZRangeWithScores(ctx, constants.FriendPrefix+id, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	friends := make([]Friend, 0, len(friendsZ))
+	for _, z := range friendsZ {
+		friends = append(friends, Friend{UserID: z.Member.(string), Since: unixToRFC3339(z.Score)})
+	}
+
+	incoming, err := collectRequests(rdb, ctx, constants.FriendRequestPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	outgoing, err := collectRequests(rdb, ctx, constants.SentRequestPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := match.GetUserMatches(rdb, ctx, userID, match.HistoryFilter{}, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kullanıcının yer aldığı her sezonun sıralaması
+	seasons, err := season.Current(rdb, ctx)
+	if err != nil {
+		return nil, err
+	}
+	standings := []Standing{}
+	for s := 1; s <= seasons; s++ {
+		rank, err := rdb.ZRevRank(ctx, season.Key(s), id).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		score, err := rdb.ZScore(ctx, season.Key(s), id).Result()
+		if err != nil {
+			return nil, err
+		}
+		standings = append(standings, Standing{Season: s, Rank: rank + 1, Score: score})
+	}
+
+	stats := []table.Row{}
+	for s := 1; s <= seasons; s++ {
+		row, err := table.Get(rdb, ctx, s, userID)
+		if err != nil {
+			return nil, err
+		}
+		if row.Played > 0 {
+			stats = append(stats, row)
+		}
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", profile},
+		{"sessions.json", sessions},
+		{"friends.json", friends},
+		{"friend_requests.json", map[string]interface{}{"received": incoming, "sent": outgoing}},
+		{"matches.json", matches},
+		{"leaderboard.json", standings},
+		{"stats.json", stats},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(file.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func collectSessions(rdb *redis.Client, ctx context.Context, id string) ([]Session, error) {
+	tokens, err := rdb.SMembers(ctx, constants.UserTokensPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		ttl, err := rdb.TTL(ctx, constants.TokenPrefix+token).Result()
+		if err != nil {
+			return nil, err
+		}
+		// Süresi dolmuş token'lar oturum sayılmaz
+		if ttl < 0 {
+			continue
+		}
+
+		// Token'ın tamamını arşive yazmıyoruz, sadece tanınabilir bir kısmı
+		sessions = append(sessions, Session{
+			Token:     token[:8] + "...",
+			ExpiresAt: time.Now().Add(ttl).Format(time.RFC3339),
+		})
+	}
+	return sessions, nil
+}
+
+func collectRequests(rdb *redis.Client, ctx context.Context, key string) ([]PendingRequest, error) {
+	requestsZ, err := rdb.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]PendingRequest, 0, len(requestsZ))
+	for _, z := range requestsZ {
+		requests = append(requests, PendingRequest{UserID: z.Member.(string), Date: unixToRFC3339(z.Score)})
+	}
+	return requests, nil
+}
+
+func unixToRFC3339(score float64) string {
+	return time.Unix(int64(score), 0).Format(time.RFC3339)
+}
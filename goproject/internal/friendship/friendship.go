@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"masomointern/internal/authent"
 	"masomointern/internal/constants"
+	"masomointern/internal/events"
 	"masomointern/internal/user"
 
 	"net/http"
@@ -191,11 +192,29 @@ func FriendRequestHandler(rdb *redis.Client, ctx context.Context) http.HandlerFu
 		timestamp := time.Now().Unix()
 		PrintLog("Timestamp obtained:", strconv.FormatInt(timestamp, 10))
 
-		// Arkadaşlık isteğini Redis'e ekle
-		err = rdb.ZAdd(ctx, constants.FriendRequestPrefix+targetUserID, &redis.Z{
-			Score:  float64(timestamp),
-			Member: userID,
-		}).Err()
+		// Gönderenin adı okunamazsa olay yalnızca ID ile yayınlanır
+		targetID, _ := strconv.Atoi(targetUserID)
+		sender, _ := user.GetUserByID(rdb, ctx, userID)
+		target, _ := user.GetUserByID(rdb, ctx, targetID)
+
+		// İstek, gönderilenler indeksi ve olay tek MULTI içinde yazılır
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, constants.FriendRequestPrefix+targetUserID, &redis.Z{
+				Score:  float64(timestamp),
+				Member: userID,
+			})
+			// Gönderilen istekleri de indeksliyoruz, hesap silinirken temizlenebilsin
+			pipe.ZAdd(ctx, constants.SentRequestPrefix+strconv.Itoa(userID), &redis.Z{
+				Score:  float64(timestamp),
+				Member: targetUserID,
+			})
+			return events.QueuePublish(pipe, ctx, events.FriendRequestSent, events.FriendRequestData{
+				FromUserID:   userID,
+				FromUsername: sender.Username,
+				ToUserID:     targetID,
+				ToUsername:   target.Username,
+			})
+		})
 		if err != nil {
 			msg := fmt.Sprintf("Failed to send friend request: %s", err)
 			PrintLog("Error:", msg)
@@ -355,26 +374,27 @@ func AcceptRejectFriendRequestHandler(rdb *redis.Client, ctx context.Context) ht
 		}
 
 		if request.Status == "accept" {
-			// Her iki kullanıcıyı da arkadaş olarak ekle
-			friendKey := constants.FriendPrefix + strconv.Itoa(userID)
-			err = rdb.ZAdd(ctx, friendKey, &redis.Z{Score: float64(time.Now().Unix()), Member: request.RequesterID}).Err()
-			if err != nil {
-				http.Error(w, "Error adding friend", http.StatusInternalServerError)
-				return
-			}
-
-			err = rdb.ZAdd(ctx, constants.FriendPrefix+request.RequesterID, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.Itoa(userID)}).Err()
+			requesterID, _ := strconv.Atoi(request.RequesterID)
+			requester, _ := user.GetUserByID(rdb, ctx, requesterID)
+			accepter, _ := user.GetUserByID(rdb, ctx, userID)
+
+			// Her iki kullanıcıyı da arkadaş olarak ekle, isteği kaldır ve olayı aynı MULTI'de yayınla
+			now := float64(time.Now().Unix())
+			_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZAdd(ctx, constants.FriendPrefix+strconv.Itoa(userID), &redis.Z{Score: now, Member: request.RequesterID})
+				pipe.ZAdd(ctx, constants.FriendPrefix+request.RequesterID, &redis.Z{Score: now, Member: strconv.Itoa(userID)})
+				pipe.ZRem(ctx, friendRequestsKey, request.RequesterID)
+				return events.QueuePublish(pipe, ctx, events.FriendRequestAccepted, events.FriendRequestData{
+					FromUserID:   requesterID,
+					FromUsername: requester.Username,
+					ToUserID:     userID,
+					ToUsername:   accepter.Username,
+				})
+			})
 			if err != nil {
 				http.Error(w, "Error adding friend", http.StatusInternalServerError)
 				return
 			}
-
-			// Arkadaşlık isteğini kaldır
-			err = rdb.ZRem(ctx, friendRequestsKey, request.RequesterID).Err()
-			if err != nil {
-				http.Error(w, "Error removing friend request", http.StatusInternalServerError)
-				return
-			}
 		} else if request.Status == "reject" {
 			// Arkadaşlık isteğini kaldır
 			err = rdb.ZRem(ctx, friendRequestsKey, request.RequesterID).Err()
@@ -384,6 +404,12 @@ func AcceptRejectFriendRequestHandler(rdb *redis.Client, ctx context.Context) ht
 			}
 		}
 
+		err = rdb.ZRem(ctx, constants.SentRequestPrefix+request.RequesterID, strconv.Itoa(userID)).Err()
+		if err != nil {
+			http.Error(w, "Error removing friend request", http.StatusInternalServerError)
+			return
+		}
+
 		// Yanıtı oluştur
 		response := Response{
 			Status: true,
@@ -434,22 +460,28 @@ func FriendListHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 			return
 		}
 
-		var friendDetails []FriendDetails
+		friendIDs := make([]int, 0, len(friends))
 		for _, friendID := range friends {
-			userData, err := rdb.Get(ctx, constants.UserPrefix+friendID).Result()
+			id, err := strconv.Atoi(friendID)
 			if err != nil {
-				if err == redis.Nil {
-					continue
-				}
-				http.Error(w, "Error retrieving user data", http.StatusInternalServerError)
+				http.Error(w, "Error parsing user data", http.StatusInternalServerError)
 				return
 			}
+			friendIDs = append(friendIDs, id)
+		}
 
-			var userDetails UserDetails
-			err = json.Unmarshal([]byte(userData), &userDetails)
-			if err != nil {
-				http.Error(w, "Error parsing user data", http.StatusInternalServerError)
-				return
+		// Arkadaşların bilgilerini tek MGET ile alıyoruz
+		users, err := user.GetUsersByIDs(rdb, ctx, friendIDs)
+		if err != nil {
+			http.Error(w, "Error retrieving user data", http.StatusInternalServerError)
+			return
+		}
+
+		var friendDetails []FriendDetails
+		for i, friendID := range friends {
+			userDetails, ok := users[friendIDs[i]]
+			if !ok {
+				continue
 			}
 
 			friendDetails = append(friendDetails, FriendDetails{
@@ -0,0 +1,176 @@
+package friendship
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	MaxSearchCount     = 50
+	searchBatch        = 100 // Filtreden önce bir seferde okunan indeks kaydı
+	FuzzyMaxDistance   = 2
+	FriendshipNone     = "none"
+	FriendshipFriend   = "friend"
+	FriendshipSent     = "request_sent"
+	FriendshipReceived = "request_received"
+)
+
+// SearchResult, arama sonucunda dönen kullanıcı bilgisi
+type SearchResult struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Friendship  string `json:"friendship"`
+}
+
+// SearchUsersHandler searches usernames by prefix, or with mode=fuzzy tolerating typos,
+// and reports the friendship status of every hit relative to the caller
+func SearchUsersHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		callerID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			http.Error(w, "Query is required", http.StatusBadRequest)
+			return
+		}
+
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 1 {
+			count = 10
+		}
+		if count > MaxSearchCount {
+			count = MaxSearchCount
+		}
+		offset := (page - 1) * count
+
+		search := func(offset, count int) ([]user.SearchHit, error) {
+			return user.SearchUsernamesByPrefix(rdb, ctx, query, offset, count)
+		}
+		if r.URL.Query().Get("mode") == "fuzzy" {
+			// Bulanık arama tüm eşleşmeleri uzaklığa göre sıralı döndürür; sayfalar bu listeden kesilir
+			matches, err := user.SearchUsernamesFuzzy(rdb, ctx, query, FuzzyMaxDistance)
+			if err != nil {
+				http.Error(w, "Error searching users", http.StatusInternalServerError)
+				return
+			}
+			search = func(offset, count int) ([]user.SearchHit, error) {
+				if offset >= len(matches) {
+					return []user.SearchHit{}, nil
+				}
+				return matches[offset:min(offset+count, len(matches))], nil
+			}
+		}
+
+		results, err := searchPage(rdb, ctx, callerID, search, offset, count)
+		if err != nil {
+			http.Error(w, "Error searching users", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{Status: true, Result: results})
+	}
+}
+
+// searchPage returns the results at [offset, offset+count) after the caller and deleted users
+// are dropped. Hits are read in batches until enough remain, so filtered hits do not leave
+// pages short.
+func searchPage(rdb *redis.Client, ctx context.Context, callerID int, search func(offset, count int) ([]user.SearchHit, error), offset, count int) ([]SearchResult, error) {
+	results := []SearchResult{}
+	for scanned := 0; len(results) < offset+count; scanned += searchBatch {
+		hits, err := search(scanned, searchBatch)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := buildSearchResults(rdb, ctx, callerID, hits)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+		if len(hits) < searchBatch {
+			break
+		}
+	}
+
+	if offset >= len(results) {
+		return []SearchResult{}, nil
+	}
+	return results[offset:min(offset+count, len(results))], nil
+}
+
+// buildSearchResults drops the caller and deleted users and attaches profile and friendship
+// data; users are read with one MGET and friendship states with one pipeline
+func buildSearchResults(rdb *redis.Client, ctx context.Context, callerID int, hits []user.SearchHit) ([]SearchResult, error) {
+	ids := make([]int, 0, len(hits))
+	for _, hit := range hits {
+		if hit.ID != callerID {
+			ids = append(ids, hit.ID)
+		}
+	}
+	users, err := user.GetUsersByIDs(rdb, ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// İndekste kalmış ama kaydı silinmiş ya da silinmeyi bekleyen kullanıcıları atlıyoruz
+	visible := make([]user.User, 0, len(ids))
+	for _, id := range ids {
+		if u, ok := users[id]; ok && u.DeletedAt == "" {
+			u.ID = id
+			visible = append(visible, u)
+		}
+	}
+
+	caller := strconv.Itoa(callerID)
+	friend := make([]*redis.FloatCmd, len(visible))
+	sent := make([]*redis.FloatCmd, len(visible))
+	received := make([]*redis.FloatCmd, len(visible))
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, u := range visible {
+			id := strconv.Itoa(u.ID)
+			friend[i] = pipe.ZScore(ctx, constants.FriendPrefix+caller, id)
+			sent[i] = pipe.ZScore(ctx, constants.FriendRequestPrefix+id, caller)
+			received[i] = pipe.ZScore(ctx, constants.FriendRequestPrefix+caller, id)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, len(visible))
+	for i, u := range visible {
+		status := FriendshipNone
+		if friend[i].Err() == nil {
+			status = FriendshipFriend
+		} else if sent[i].Err() == nil {
+			status = FriendshipSent
+		} else if received[i].Err() == nil {
+			status = FriendshipReceived
+		}
+		results[i] = SearchResult{
+			ID:          u.ID,
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+			Friendship:  status,
+		}
+	}
+	return results, nil
+}
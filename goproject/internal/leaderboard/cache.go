@@ -0,0 +1,156 @@
+package leaderboard
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PageCache, sıralama sayfalarının işlenmiş yanıtlarını süreç içinde tutan LRU önbellek.
+// Anahtarlar sıralamanın kendi sürümünü içerir; puanlar değişince eski sayfalar bir daha okunmaz ve zamanla düşer.
+type PageCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // En son kullanılan başta
+	entries map[string]*list.Element
+
+	hits        int64
+	misses      int64
+	notModified int64
+	evictions   int64
+}
+
+// CachedPage, önbellekteki bir sayfa yanıtı
+type CachedPage struct {
+	Body []byte
+	ETag string
+}
+
+type pageEntry struct {
+	key     string
+	page    CachedPage
+	expires time.Time
+}
+
+// CacheStats, sayfa önbelleğinin sayaçları
+type CacheStats struct {
+	Entries     int     `json:"entries"`
+	Size        int     `json:"size"`
+	TTL         string  `json:"ttl"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	NotModified int64   `json:"not_modified"` // Hit'lerden 304 ile yanıtlananlar
+	Evictions   int64   `json:"evictions"`
+	HitRate     float64 `json:"hit_rate"`
+}
+
+// Pages, sıralama sayfaları için kullanılan önbellek; ayarlar main içinde değiştirilebilir
+var Pages = NewPageCache(1000, 10*time.Second)
+
+// NewPageCache returns a cache holding up to size pages for ttl each; a size or ttl of 0
+// disables caching
+func NewPageCache(size int, ttl time.Duration) *PageCache {
+	return &PageCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Enabled reports whether the cache stores pages at all
+func (c *PageCache) Enabled() bool {
+	return c.size > 0 && c.ttl > 0
+}
+
+// Get returns a cached page that has not expired
+func (c *PageCache) Get(key string) (CachedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok && time.Now().After(el.Value.(*pageEntry).expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return CachedPage{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*pageEntry).page, true
+}
+
+// Put stores a rendered page, evicting the least recently used one when full, and returns
+// it with its ETag filled in
+func (c *PageCache) Put(key string, body []byte) CachedPage {
+	sum := sha1.Sum(body)
+	page := CachedPage{Body: body, ETag: `"` + hex.EncodeToString(sum[:10]) + `"`}
+	if !c.Enabled() {
+		return page
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &pageEntry{key: key, page: page, expires: time.Now().Add(c.ttl)}
+		c.order.MoveToFront(el)
+		return page
+	}
+	c.entries[key] = c.order.PushFront(&pageEntry{key: key, page: page, expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pageEntry).key)
+		c.evictions++
+	}
+	return page
+}
+
+// NotModified counts a hit answered with 304 Not Modified
+func (c *PageCache) NotModified() {
+	c.mu.Lock()
+	c.notModified++
+	c.mu.Unlock()
+}
+
+// Stats returns the cache counters
+func (c *PageCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Entries:     c.order.Len(),
+		Size:        c.size,
+		TTL:         c.ttl.String(),
+		Hits:        c.hits,
+		Misses:      c.misses,
+		NotModified: c.notModified,
+		Evictions:   c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// Version returns a board's version, which every score change on that board increments. Cached
+// pages are keyed by it so all server instances stop serving a page once the scores behind it change.
+func Version(rdb *redis.Client, ctx context.Context, key string) (int64, error) {
+	version, err := rdb.Get(ctx, key+constants.BoardVersionSuffix).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
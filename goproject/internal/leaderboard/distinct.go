@@ -0,0 +1,171 @@
+package leaderboard
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"masomointern/internal/constants"
+	"masomointern/internal/season"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Her sıralamanın yanında farklı skorların kümesi ve her skordaki oyuncu sayısı tutulur; böylece
+// yoğun sıra tek bir ZCOUNT ile bulunur.
+
+// scoreScript changes a player's score and keeps the board's distinct score set in step.
+// ARGV[2] is "incr" to add ARGV[3] to the score or "rem" to remove the player.
+var scoreScript = redis.NewScript(`
+local old = redis.call("ZSCORE", KEYS[1], ARGV[1])
+local new
+if ARGV[2] == "incr" then
+	new = redis.call("ZINCRBY", KEYS[1], ARGV[3], ARGV[1])
+else
+	redis.call("ZREM", KEYS[1], ARGV[1])
+end
+if old and redis.call("HINCRBY", KEYS[3], old, -1) <= 0 then
+	redis.call("HDEL", KEYS[3], old)
+	redis.call("ZREM", KEYS[2], old)
+end
+if new and redis.call("HINCRBY", KEYS[3], new, 1) == 1 then
+	redis.call("ZADD", KEYS[2], new, new)
+end
+return new
+`)
+
+// rebuildScript, bir sıralamanın farklı skor kümesini baştan kurar
+var rebuildScript = redis.NewScript(`
+redis.call("DEL", KEYS[2], KEYS[3])
+local members = redis.call("ZRANGE", KEYS[1], 0, -1, "WITHSCORES")
+for i = 2, #members, 2 do
+	if redis.call("HINCRBY", KEYS[3], members[i], 1) == 1 then
+		redis.call("ZADD", KEYS[2], members[i], members[i])
+	end
+end
+return #members / 2
+`)
+
+// scoreKeys returns a board with its distinct score set and score counts
+func scoreKeys(key string) []string {
+	return []string{key, key + constants.BoardScoresSuffix, key + constants.BoardScoreCountsSuffix}
+}
+
+// RebuildDistinctScores builds the distinct score sets of boards written before they existed:
+// every season board and the period buckets still kept. It runs once.
+func RebuildDistinctScores(rdb *redis.Client, ctx context.Context) error {
+	built, err := rdb.Exists(ctx, constants.DistinctScoresBuilt).Result()
+	if err != nil || built > 0 {
+		return err
+	}
+
+	current, err := season.Current(rdb, ctx)
+	if err != nil {
+		return err
+	}
+	boards := ActiveKeys(time.Now())
+	for id := 1; id <= current; id++ {
+		boards = append(boards, season.Key(id))
+	}
+
+	for _, key := range boards {
+		ttl, err := rdb.TTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		err = rebuildScript.Run(ctx, rdb, scoreKeys(key)).Err()
+		if err != nil {
+			return err
+		}
+		// Dönem sıralamalarının kümeleri sıralamayla birlikte silinir
+		if ttl > 0 {
+			_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, k := range scoreKeys(key)[1:] {
+					pipe.Expire(ctx, k, ttl)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return rdb.Set(ctx, constants.DistinctScoresBuilt, time.Now().Format(time.RFC3339), 0).Err()
+}
+
+// distinctAbove, verilen skordan yüksek kaç farklı skor olduğunu sunucu tarafında sayar. Yalnızca
+// farklı skor kümesi olmayan türetilmiş sıralamalarda (7 günlük görünüm, arkadaş sıralaması) kullanılır.
+var distinctAbove = redis.NewScript(`
+local count = 0
+local max = '+inf'
+while true do
+	local r = redis.call('ZREVRANGEBYSCORE', KEYS[1], max, '(' .. ARGV[1], 'WITHSCORES', 'LIMIT', 0, 1)
+	if #r == 0 then
+		return count
+	end
+	count = count + 1
+	max = '(' .. r[2]
+end
+`)
+
+// denseCacheThreshold, yoğun sıra sayımının önbelleğe alınacağı en az üstteki oyuncu sayısı;
+// küçük sıralamalarda betik zaten ucuzdur
+const denseCacheThreshold = 1000
+
+// maxDenseCache, önbellekte tutulan en fazla yoğun sıra sayımı
+const maxDenseCache = 10000
+
+// denseCounts, distinctAbove sonuçları; anahtar sıralamanın sürümünü içerir
+var denseCounts = struct {
+	sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// countDistinctAbove returns the number of distinct scores above score; above is the number of
+// players above. Boards keep a distinct score set, so this is a single ZCOUNT. Derived boards
+// built with ZUNIONSTORE or ZINTERSTORE have none; their count walks the scores above and on
+// large boards is cached until the board's version changes.
+func countDistinctAbove(rdb *redis.Client, ctx context.Context, key string, score float64, above int64) (int64, error) {
+	var exists, count *redis.IntCmd
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, key+constants.BoardScoresSuffix)
+		count = pipe.ZCount(ctx, key+constants.BoardScoresSuffix, "("+formatScore(score), "+inf")
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if exists.Val() > 0 {
+		return count.Val(), nil
+	}
+	if above < denseCacheThreshold {
+		return distinctAbove.Run(ctx, rdb, []string{key}, formatScore(score)).Int64()
+	}
+
+	version, err := Version(rdb, ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	cacheKey := key + "|" + strconv.FormatInt(version, 10) + "|" + formatScore(score)
+
+	denseCounts.Lock()
+	cached, ok := denseCounts.counts[cacheKey]
+	denseCounts.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	walked, err := distinctAbove.Run(ctx, rdb, []string{key}, formatScore(score)).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	denseCounts.Lock()
+	if len(denseCounts.counts) >= maxDenseCache {
+		denseCounts.counts = make(map[string]int64)
+	}
+	denseCounts.counts[cacheKey] = walked
+	denseCounts.Unlock()
+	return walked, nil
+}
@@ -0,0 +1,182 @@
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"masomointern/internal/constants"
+	"masomointern/internal/season"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	PeriodAllTime = "alltime"
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodRolling = "7d" // Son 7 günlük kayan pencere
+)
+
+var (
+	// Dönem sıralamalarının son yazmadan sonra ne kadar saklanacağı
+	DailyRetention   = 8 * 24 * time.Hour // Kayan 7 günlük görünüm için en az 7 gün olmalı
+	WeeklyRetention  = 5 * 7 * 24 * time.Hour
+	MonthlyRetention = 400 * 24 * time.Hour
+
+	// RollingCacheTTL, ZUNIONSTORE ile üretilen 7 günlük görünümün yeniden hesaplanma aralığı
+	RollingCacheTTL = time.Minute
+
+	// Dönem sınırları bu saat dilimine göre belirlenir
+	Location = time.UTC
+)
+
+var ErrUnknownPeriod = errors.New("Unknown leaderboard period")
+
+// periodKeys, bir anda yazılan günlük, haftalık ve aylık anahtarlar ile saklama süreleri
+func periodKeys(at time.Time) map[string]time.Duration {
+	return map[string]time.Duration{
+		PeriodKey(PeriodDaily, at):   DailyRetention,
+		PeriodKey(PeriodWeekly, at):  WeeklyRetention,
+		PeriodKey(PeriodMonthly, at): MonthlyRetention,
+	}
+}
+
+// PeriodKey returns the bucket key of a daily, weekly (ISO week) or monthly leaderboard
+func PeriodKey(period string, at time.Time) string {
+	at = at.In(Location)
+	switch period {
+	case PeriodDaily:
+		return constants.PeriodLeaderboardPrefix + "daily:" + at.Format(time.DateOnly)
+	case PeriodWeekly:
+		year, week := at.ISOWeek()
+		return constants.PeriodLeaderboardPrefix + fmt.Sprintf("weekly:%d-W%02d", year, week)
+	case PeriodMonthly:
+		return constants.PeriodLeaderboardPrefix + "monthly:" + at.Format("2006-01")
+	}
+	return ""
+}
+
+// Result, bir oyuncunun maçtan sıralamaya yazılan katkısı
+type Result struct {
+	UserID         int
+	Points         float64
+	GoalDifference int
+	Opponents      []int // Yalnızca iki oyunculu maçlarda; ikili averaj için
+}
+
+// QueueResult adds a player's points and tiebreaker data to the season leaderboard
+// and the current period buckets
+func QueueResult(pipe redis.Pipeliner, ctx context.Context, seasonKey string, r Result, at time.Time) {
+	queueBoard(pipe, ctx, seasonKey, r, at, 0)
+	for key, retention := range periodKeys(at) {
+		queueBoard(pipe, ctx, key, r, at, retention)
+	}
+}
+
+// queueBoard writes a result to one board; retention 0 keeps the keys forever
+func queueBoard(pipe redis.Pipeliner, ctx context.Context, key string, r Result, at time.Time, retention time.Duration) {
+	member := strconv.Itoa(r.UserID)
+	keys := append(scoreKeys(key), key+achievedSuffix, key+goalDifferenceSuffix, key+constants.BoardVersionSuffix)
+
+	scoreScript.Eval(ctx, pipe, scoreKeys(key), member, "incr", r.Points)
+	// Puanı değişmeyen oyuncunun o puana ulaşma zamanı korunur
+	if r.Points != 0 {
+		pipe.HSet(ctx, key+achievedSuffix, member, at.Unix())
+	}
+	pipe.HIncrBy(ctx, key+goalDifferenceSuffix, member, int64(r.GoalDifference))
+	for _, opponent := range r.Opponents {
+		h2h := key + headToHeadSuffix + member
+		pipe.HIncrByFloat(ctx, h2h, strconv.Itoa(opponent), r.Points)
+		keys = append(keys, h2h)
+	}
+	pipe.Incr(ctx, key+constants.BoardVersionSuffix)
+
+	if retention > 0 {
+		for _, k := range keys {
+			pipe.Expire(ctx, k, retention)
+		}
+	}
+}
+
+// ActiveKeys lists every period bucket that may still exist at the given time
+func ActiveKeys(at time.Time) []string {
+	keys := []string{}
+	for d := time.Duration(0); d <= DailyRetention; d += 24 * time.Hour {
+		keys = append(keys, PeriodKey(PeriodDaily, at.Add(-d)))
+	}
+	for d := time.Duration(0); d <= WeeklyRetention; d += 7 * 24 * time.Hour {
+		keys = append(keys, PeriodKey(PeriodWeekly, at.Add(-d)))
+	}
+	local := at.In(Location)
+	month := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, Location)
+	for i := 0; i <= int(MonthlyRetention/(28*24*time.Hour)); i++ {
+		keys = append(keys, PeriodKey(PeriodMonthly, month.AddDate(0, -i, 0)))
+	}
+	return keys
+}
+
+// rollingDays returns the daily boards making up the seven-day view ending at the given day
+func rollingDays(at time.Time) []string {
+	days := make([]string, 7)
+	for i := range days {
+		days[i] = PeriodKey(PeriodDaily, at.AddDate(0, 0, -i))
+	}
+	return days
+}
+
+// statsSources returns the boards holding a board's tiebreaker data. The seven-day view only
+// stores the summed scores; its tiebreakers are combined from the daily boards when a tied
+// group is ordered.
+func statsSources(key string) []string {
+	prefix := constants.PeriodLeaderboardPrefix + PeriodRolling + ":"
+	if !strings.HasPrefix(key, prefix) {
+		return []string{key}
+	}
+	at, err := time.ParseInLocation(time.DateOnly, strings.TrimPrefix(key, prefix), Location)
+	if err != nil {
+		return []string{key}
+	}
+	return rollingDays(at)
+}
+
+// rollingKey builds the last seven days' view with ZUNIONSTORE and caches it briefly. Each build
+// gets its own version stamp, so only pages of this view are cached per build.
+func rollingKey(rdb *redis.Client, ctx context.Context, at time.Time) (string, error) {
+	key := constants.PeriodLeaderboardPrefix + PeriodRolling + ":" + at.In(Location).Format(time.DateOnly)
+
+	exists, err := rdb.Exists(ctx, key).Result()
+	if err != nil || exists > 0 {
+		return key, err
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(ctx, key, &redis.ZStore{Keys: rollingDays(at), Aggregate: "SUM"})
+		pipe.Expire(ctx, key, RollingCacheTTL)
+		// Yalnızca bu görünümün sürümü değişir; diğer sıralamaların önbellekleri korunur
+		pipe.Set(ctx, key+constants.BoardVersionSuffix, time.Now().UnixNano(), RollingCacheTTL)
+		return nil
+	})
+	return key, err
+}
+
+// Key resolves the sorted set to read for a period. seasonID only applies to the all-time
+// view and defaults to the running season when 0.
+func Key(rdb *redis.Client, ctx context.Context, period string, seasonID int, at time.Time) (string, error) {
+	switch period {
+	case "", PeriodAllTime:
+		if seasonID == 0 {
+			return season.CurrentKey(rdb, ctx)
+		}
+		return season.Key(seasonID), nil
+	case PeriodDaily, PeriodWeekly, PeriodMonthly:
+		return PeriodKey(period, at), nil
+	case PeriodRolling:
+		return rollingKey(rdb, ctx, at)
+	}
+	return "", ErrUnknownPeriod
+}
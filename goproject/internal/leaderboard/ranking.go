@@ -0,0 +1,396 @@
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	RankCompetition = "competition" // 1, 2, 2, 4
+	RankDense       = "dense"       // 1, 2, 2, 3
+	RankOrdinal     = "ordinal"     // 1, 2, 3, 4; eşitlik bozucuların sırası kullanılır
+
+	TiebreakGoalDifference = "goal_difference"
+	TiebreakHeadToHead     = "head_to_head"
+	TiebreakAchieved       = "achieved" // Puana önce ulaşan önde
+)
+
+// Sıralama anahtarının yanında tutulan eşitlik bozucu verilerinin sonekleri
+const (
+	achievedSuffix       = ":achieved"
+	goalDifferenceSuffix = ":gd"
+	headToHeadSuffix     = ":h2h:"
+)
+
+var (
+	// RankingMode, eşit puanlı oyunculara sıra numarası verme biçimi
+	RankingMode = RankCompetition
+
+	// Tiebreakers, eşit puanlı oyuncuları sıralarken sırayla uygulanır; en son kullanıcı ID'si bakılır
+	Tiebreakers = []string{TiebreakGoalDifference, TiebreakHeadToHead, TiebreakAchieved}
+
+	// MaxTieGroup, eşitlik bozucuların uygulanacağı en büyük eşit puanlı grup. Daha büyük gruplar
+	// Redis'in üye sırasıyla (ID'nin metin sırası) okunur, böylece yalnızca sayfadaki kısım okunur.
+	MaxTieGroup = 1000
+
+	// MaxHeadToHeadGroup, ikili averajın hesaplanacağı en büyük grup
+	MaxHeadToHeadGroup = 50
+)
+
+var ErrUnknownRankingMode = errors.New("Unknown ranking mode")
+
+// Entry, sıralamadaki bir oyuncu
+type Entry struct {
+	UserID         int
+	Score          float64
+	Rank           int
+	GoalDifference int
+}
+
+// ValidMode reports whether mode is a known ranking mode
+func ValidMode(mode string) bool {
+	return mode == RankCompetition || mode == RankDense || mode == RankOrdinal
+}
+
+// ValidTiebreaker reports whether name is a known tiebreaker
+func ValidTiebreaker(name string) bool {
+	return name == TiebreakGoalDifference || name == TiebreakHeadToHead || name == TiebreakAchieved
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// tieStats, bir eşit puanlı grubun eşitlik bozucu verileri
+type tieStats struct {
+	achieved       map[int]int64
+	goalDifference map[int]int
+	headToHead     map[int]float64 // Grup içindeki rakiplere karşı toplanan puan
+}
+
+// loadTieStats reads the tiebreaker data of a tied group from the statsKey board. For the
+// seven-day view goal difference and head-to-head points are summed over the daily boards and
+// the latest day a player scored counts as the time they reached their score.
+func loadTieStats(rdb *redis.Client, ctx context.Context, statsKey string, ids []int) (tieStats, error) {
+	stats := tieStats{
+		achieved:       make(map[int]int64, len(ids)),
+		goalDifference: make(map[int]int, len(ids)),
+		headToHead:     make(map[int]float64, len(ids)),
+	}
+	if len(ids) == 0 || len(ids) > MaxTieGroup {
+		return stats, nil
+	}
+
+	fields := make([]string, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.Itoa(id)
+	}
+	withH2H := len(ids) > 1 && len(ids) <= MaxHeadToHeadGroup
+
+	sources := statsSources(statsKey)
+	achieved := make([]*redis.SliceCmd, len(sources))
+	goalDifference := make([]*redis.SliceCmd, len(sources))
+	h2h := make([][]*redis.SliceCmd, len(sources))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for s, source := range sources {
+			achieved[s] = pipe.HMGet(ctx, source+achievedSuffix, fields...)
+			goalDifference[s] = pipe.HMGet(ctx, source+goalDifferenceSuffix, fields...)
+			if withH2H {
+				h2h[s] = make([]*redis.SliceCmd, len(ids))
+				for i, field := range fields {
+					h2h[s][i] = pipe.HMGet(ctx, source+headToHeadSuffix+field, fields...)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for s := range sources {
+		for i, id := range ids {
+			if v, ok := achieved[s].Val()[i].(string); ok {
+				at, _ := strconv.ParseInt(v, 10, 64)
+				if at > stats.achieved[id] {
+					stats.achieved[id] = at
+				}
+			}
+			if v, ok := goalDifference[s].Val()[i].(string); ok {
+				gd, _ := strconv.Atoi(v)
+				stats.goalDifference[id] += gd
+			}
+			if withH2H {
+				for _, value := range h2h[s][i].Val() {
+					if v, ok := value.(string); ok {
+						points, _ := strconv.ParseFloat(v, 64)
+						stats.headToHead[id] += points
+					}
+				}
+			}
+		}
+	}
+	return stats, nil
+}
+
+// compare returns a negative number if a ranks above b on the configured tiebreakers, 0 if
+// they are still tied
+func (stats tieStats) compare(a, b int) int {
+	for _, tiebreaker := range Tiebreakers {
+		switch tiebreaker {
+		case TiebreakGoalDifference:
+			if d := stats.goalDifference[b] - stats.goalDifference[a]; d != 0 {
+				return d
+			}
+		case TiebreakHeadToHead:
+			if d := stats.headToHead[b] - stats.headToHead[a]; d != 0 {
+				if d > 0 {
+					return 1
+				}
+				return -1
+			}
+		case TiebreakAchieved:
+			// Zamanı bilinmeyen oyuncu sona kalır
+			ta, okA := stats.achieved[a]
+			tb, okB := stats.achieved[b]
+			if okA != okB {
+				if okA {
+					return -1
+				}
+				return 1
+			}
+			if ta != tb {
+				if ta < tb {
+					return -1
+				}
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// orderGroup returns the members at positions [from, to) of the tied group with the given score
+// and size. Groups of up to MaxTieGroup players are sorted by the tiebreakers, then by user ID;
+// larger ones keep Redis' member order so only the requested slice is read.
+func orderGroup(rdb *redis.Client, ctx context.Context, key, statsKey string, score float64, size, from, to int) ([]int, tieStats, error) {
+	if from >= to {
+		return []int{}, tieStats{}, nil
+	}
+	rangeBy := &redis.ZRangeBy{Min: formatScore(score), Max: formatScore(score), Count: int64(MaxTieGroup)}
+	large := size > MaxTieGroup
+	if large {
+		rangeBy.Offset, rangeBy.Count = int64(from), int64(to-from)
+	}
+	members, err := rdb.ZRangeByScore(ctx, key, rangeBy).Result()
+	if err != nil {
+		return nil, tieStats{}, err
+	}
+
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.Atoi(member)
+		if err != nil {
+			return nil, tieStats{}, err
+		}
+		ids = append(ids, id)
+	}
+
+	// Büyük grupta istatistikler yalnızca gösterilen oyuncular için okunur
+	stats, err := loadTieStats(rdb, ctx, statsKey, ids)
+	if err != nil {
+		return nil, tieStats{}, err
+	}
+	if large {
+		return ids, stats, nil
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		if c := stats.compare(ids[i], ids[j]); c != 0 {
+			return c < 0
+		}
+		return ids[i] < ids[j]
+	})
+	// Okuma ile sayım arasında grup değişmiş olabilir
+	if to > len(ids) {
+		to = len(ids)
+	}
+	if from > to {
+		from = to
+	}
+	return ids[from:to], stats, nil
+}
+
+// Page returns count players starting at position start, ordered by score and the tiebreakers
+// and numbered according to mode. Tiebreaker data is read from statsKey's board, which is
+// usually key itself.
+func Page(rdb *redis.Client, ctx context.Context, key, statsKey string, start, count int, mode string) ([]Entry, error) {
+	if !ValidMode(mode) {
+		return nil, ErrUnknownRankingMode
+	}
+
+	page, err := rdb.ZRevRangeWithScores(ctx, key, int64(start), int64(start+count-1)).Result()
+	if err != nil || len(page) == 0 {
+		return []Entry{}, err
+	}
+
+	// Sayfa sınırındaki eşit puanlı gruplar eşitlik bozuculara göre sıralanıp sayfaya düşen kısımları alınır
+	top := page[0].Score
+	above, err := rdb.ZCount(ctx, key, "("+formatScore(top), "+inf").Result()
+	if err != nil {
+		return nil, err
+	}
+	denseAbove := int64(0)
+	if mode == RankDense && above > 0 {
+		denseAbove, err = countDistinctAbove(rdb, ctx, key, top, above)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scores := []float64{}
+	for _, z := range page {
+		if len(scores) == 0 || scores[len(scores)-1] != z.Score {
+			scores = append(scores, z.Score)
+		}
+	}
+	sizes := make([]*redis.IntCmd, len(scores))
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for g, score := range scores {
+			sizes[g] = pipe.ZCount(ctx, key, formatScore(score), formatScore(score))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	end := start + len(page)
+	groupStart := int(above)
+	entries := make([]Entry, 0, len(page))
+	for g, score := range scores {
+		size := int(sizes[g].Val())
+		from := start - groupStart
+		if from < 0 {
+			from = 0
+		}
+		to := end - groupStart
+		if to > size {
+			to = size
+		}
+
+		ids, stats, err := orderGroup(rdb, ctx, key, statsKey, score, size, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			e := Entry{UserID: id, Score: score, GoalDifference: stats.goalDifference[id]}
+			switch mode {
+			case RankCompetition:
+				e.Rank = groupStart + 1
+			case RankDense:
+				e.Rank = int(denseAbove) + g + 1
+			case RankOrdinal:
+				e.Rank = groupStart + from + i + 1
+			}
+			entries = append(entries, e)
+		}
+		groupStart += size
+	}
+	return entries, nil
+}
+
+// Position returns the zero-based position of a player in tiebreaker order
+func Position(rdb *redis.Client, ctx context.Context, key, statsKey string, userID int) (int, error) {
+	member := strconv.Itoa(userID)
+	score, err := rdb.ZScore(ctx, key, member).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var above, size, rank, below *redis.IntCmd
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		above = pipe.ZCount(ctx, key, "("+formatScore(score), "+inf")
+		size = pipe.ZCount(ctx, key, formatScore(score), formatScore(score))
+		rank = pipe.ZRank(ctx, key, member)
+		below = pipe.ZCount(ctx, key, "-inf", "("+formatScore(score))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Büyük grupta sıra Redis'in üye sırasıdır: grup içindeki yer ZRANK'ten bulunur
+	if size.Val() > int64(MaxTieGroup) {
+		return int(above.Val() + rank.Val() - below.Val()), nil
+	}
+
+	ids, _, err := orderGroup(rdb, ctx, key, statsKey, score, int(size.Val()), 0, int(size.Val()))
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if id == userID {
+			return int(above.Val()) + i, nil
+		}
+	}
+	return int(above.Val()), nil
+}
+
+// Opponents returns the players the user has head-to-head records against on a board
+func Opponents(c redis.Cmdable, ctx context.Context, key string, userID int) ([]string, error) {
+	return c.HKeys(ctx, key+headToHeadSuffix+strconv.Itoa(userID)).Result()
+}
+
+// QueueRemove removes a player and their tiebreaker data from a board
+func QueueRemove(pipe redis.Pipeliner, ctx context.Context, key string, userID int, opponents []string) {
+	member := strconv.Itoa(userID)
+	scoreScript.Eval(ctx, pipe, scoreKeys(key), member, "rem", 0)
+	pipe.HDel(ctx, key+achievedSuffix, member)
+	pipe.HDel(ctx, key+goalDifferenceSuffix, member)
+	pipe.Del(ctx, key+headToHeadSuffix+member)
+	for _, opponent := range opponents {
+		pipe.HDel(ctx, key+headToHeadSuffix+opponent, member)
+	}
+	pipe.Incr(ctx, key+constants.BoardVersionSuffix)
+}
+
+// Ranks returns the competition ranks (1 + players with a higher score) of several players;
+// players who are not on the board are left out
+func Ranks(rdb *redis.Client, ctx context.Context, key string, userIDs []int) (map[int]int, error) {
+	scores := make([]*redis.FloatCmd, len(userIDs))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range userIDs {
+			scores[i] = pipe.ZScore(ctx, key, strconv.Itoa(id))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	above := make(map[int]*redis.IntCmd, len(userIDs))
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range userIDs {
+			if scores[i].Err() == nil {
+				above[id] = pipe.ZCount(ctx, key, "("+formatScore(scores[i].Val()), "+inf")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ranks := make(map[int]int, len(above))
+	for id, cmd := range above {
+		ranks[id] = int(cmd.Val()) + 1
+	}
+	return ranks, nil
+}
@@ -0,0 +1,435 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/scoring"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	RequireConfirmation  = false          // true ise tüm oyuncu bildirimleri rakip onayı bekler
+	ConfirmationDeadline = 24 * time.Hour // Rakibin onaylama ya da itiraz etme süresi
+	PendingRetention     = 30 * 24 * time.Hour
+)
+
+const (
+	PendingAwaiting    = "pending"
+	PendingConfirmed   = "confirmed"
+	PendingAutoApplied = "auto_applied"
+	PendingDisputed    = "disputed"
+	PendingResolved    = "resolved"
+	PendingVoided      = "voided"
+)
+
+var ErrPendingNotFound = errors.New("Pending match not found")
+
+// PendingMatch, rakip onayı bekleyen bir maç bildirimi
+type PendingMatch struct {
+	ID            int         `json:"id"`
+	Report        MatchReport `json:"report"`
+	ReporterID    int         `json:"reporter_id"`
+	OpponentID    int         `json:"opponent_id"`
+	Status        string      `json:"status"`
+	Deadline      string      `json:"deadline"`
+	CreatedAt     string      `json:"created_at"`
+	DisputeReason string      `json:"dispute_reason,omitempty"`
+	Resolution    string      `json:"resolution,omitempty"`
+}
+
+func savePending(rdb *redis.Client, ctx context.Context, p PendingMatch, ttl time.Duration) error {
+	pendingJSON, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, constants.PendingMatchPrefix+strconv.Itoa(p.ID), pendingJSON, ttl).Err()
+}
+
+// GetPendingMatch loads a pending match by ID
+func GetPendingMatch(rdb *redis.Client, ctx context.Context, id int) (PendingMatch, error) {
+	pendingJSON, err := rdb.Get(ctx, constants.PendingMatchPrefix+strconv.Itoa(id)).Result()
+	if err == redis.Nil {
+		return PendingMatch{}, ErrPendingNotFound
+	} else if err != nil {
+		return PendingMatch{}, err
+	}
+
+	var p PendingMatch
+	err = json.Unmarshal([]byte(pendingJSON), &p)
+	return p, err
+}
+
+// submitPending stores a report that waits for the opponent's confirmation
+func submitPending(rdb *redis.Client, ctx context.Context, report MatchReport, reporterID int) (PendingMatch, error) {
+	id, err := NewMatchID(rdb, ctx)
+	if err != nil {
+		return PendingMatch{}, err
+	}
+
+	opponentID := report.UserID1
+	if reporterID == report.UserID1 {
+		opponentID = report.UserID2
+	}
+
+	now := time.Now()
+	deadline := now.Add(ConfirmationDeadline)
+	p := PendingMatch{
+		ID:         id,
+		Report:     report,
+		ReporterID: reporterID,
+		OpponentID: opponentID,
+		Status:     PendingAwaiting,
+		Deadline:   deadline.Format(time.RFC3339),
+		CreatedAt:  now.Format(time.RFC3339),
+	}
+
+	err = savePending(rdb, ctx, p, ConfirmationDeadline+PendingRetention)
+	if err != nil {
+		return PendingMatch{}, err
+	}
+
+	matchID := strconv.Itoa(id)
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, constants.PendingDeadlines, &redis.Z{Score: float64(deadline.Unix()), Member: matchID})
+		pipe.ZAdd(ctx, constants.UserPendingPrefix+strconv.Itoa(opponentID), &redis.Z{Score: float64(deadline.Unix()), Member: matchID})
+		return nil
+	})
+	return p, err
+}
+
+// claimPending atomically removes the match from queue; only the caller that removed it may act on it,
+// so a confirmation and the deadline worker can never both apply the same match
+func claimPending(rdb *redis.Client, ctx context.Context, queue string, p PendingMatch) (bool, error) {
+	matchID := strconv.Itoa(p.ID)
+	removed, err := rdb.ZRem(ctx, queue, matchID).Result()
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	rdb.ZRem(ctx, constants.UserPendingPrefix+strconv.Itoa(p.OpponentID), matchID)
+	return true, nil
+}
+
+// applyPending records a match claimed from queue on the leaderboard and marks it with status.
+// It returns the HTTP status to use on failure: 422 if the report no longer passes validation
+// and the match was voided, 500 otherwise.
+func applyPending(rdb *redis.Client, ctx context.Context, queue string, p PendingMatch, report MatchReport, status string) (Match, int, error) {
+	// Bekleme süresince oyunculardan biri silinmiş ya da skorlar geçersiz düzeltilmiş olabilir
+	rules, err := scoring.ForLeague(rdb, ctx, report.League)
+	if err != nil {
+		rdb.ZAdd(ctx, queue, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.Itoa(p.ID)})
+		return Match{}, http.StatusInternalServerError, err
+	}
+	m, err := buildMatch(report, rules)
+	code := http.StatusUnprocessableEntity
+	if err == nil {
+		code, err = validateReport(rdb, ctx, m)
+		if code == http.StatusInternalServerError {
+			rdb.ZAdd(ctx, queue, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.Itoa(p.ID)})
+			return Match{}, code, err
+		}
+	}
+	if err != nil {
+		p.Status = PendingVoided
+		p.Resolution = err.Error()
+		savePending(rdb, ctx, p, PendingRetention)
+		return Match{}, http.StatusUnprocessableEntity, err
+	}
+
+	m.ID = p.ID
+	err = RecordMatch(rdb, ctx, &m)
+	if err != nil {
+		// Geçici bir hata; maçı alındığı kuyruğa geri koyuyoruz ki tekrar denenebilsin
+		rdb.ZAdd(ctx, queue, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.Itoa(p.ID)})
+		return Match{}, http.StatusInternalServerError, err
+	}
+
+	p.Status = status
+	p.Report = report
+	return m, 0, savePending(rdb, ctx, p, PendingRetention)
+}
+
+// PendingMatchesHandler lists reports waiting for the caller's confirmation
+func PendingMatchesHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ids, err := rdb.ZRange(ctx, constants.UserPendingPrefix+strconv.Itoa(userID), 0, -1).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		pending := []PendingMatch{}
+		for _, idStr := range ids {
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				continue
+			}
+			p, err := GetPendingMatch(rdb, ctx, id)
+			if err == ErrPendingNotFound {
+				continue
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			pending = append(pending, p)
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: pending})
+	}
+}
+
+// ConfirmMatchHandler lets the opponent confirm a pending report, which applies it,
+// or dispute it, which sends it to the moderator queue
+func ConfirmMatchHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			MatchID int    `json:"match_id"`
+			Action  string `json:"action"`
+			Reason  string `json:"reason"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Action != "confirm" && request.Action != "dispute" {
+			http.Error(w, "Action must be confirm or dispute", http.StatusBadRequest)
+			return
+		}
+
+		p, err := GetPendingMatch(rdb, ctx, request.MatchID)
+		if err == ErrPendingNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if p.OpponentID != userID {
+			http.Error(w, "Only the opponent can confirm or dispute this match", http.StatusForbidden)
+			return
+		}
+
+		claimed, err := claimPending(rdb, ctx, constants.PendingDeadlines, p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			http.Error(w, "Match was already processed", http.StatusConflict)
+			return
+		}
+
+		if request.Action == "dispute" {
+			p.Status = PendingDisputed
+			p.DisputeReason = request.Reason
+			// İtiraz edilen kayıt moderatör karar verene kadar silinmez
+			err = savePending(rdb, ctx, p, 0)
+			if err == nil {
+				err = rdb.ZAdd(ctx, constants.DisputeQueue, &redis.Z{Score: float64(time.Now().Unix()), Member: strconv.Itoa(p.ID)}).Err()
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(Response{Status: true, Result: p})
+			return
+		}
+
+		m, status, err := applyPending(rdb, ctx, constants.PendingDeadlines, p, p.Report, PendingConfirmed)
+		if err != nil {
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: m})
+	}
+}
+
+// DisputesHandler lists disputed matches, oldest first; moderators only
+func DisputesHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Moderator credential required", http.StatusForbidden)
+			return
+		}
+
+		ids, err := rdb.ZRange(ctx, constants.DisputeQueue, 0, -1).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		disputes := []PendingMatch{}
+		for _, idStr := range ids {
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				continue
+			}
+			p, err := GetPendingMatch(rdb, ctx, id)
+			if err == ErrPendingNotFound {
+				// Kaydı kalmamış itiraz kuyruktan çıkarılır
+				rdb.ZRem(ctx, constants.DisputeQueue, idStr)
+				continue
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			disputes = append(disputes, p)
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: disputes})
+	}
+}
+
+// ResolveDisputeHandler lets a moderator apply a disputed match, optionally with corrected scores, or void it
+func ResolveDisputeHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Moderator credential required", http.StatusForbidden)
+			return
+		}
+
+		var request struct {
+			MatchID  int    `json:"match_id"`
+			Decision string `json:"decision"`
+			Score1   *int   `json:"score1"`
+			Score2   *int   `json:"score2"`
+			Note     string `json:"note"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Decision != "apply" && request.Decision != "void" {
+			http.Error(w, "Decision must be apply or void", http.StatusBadRequest)
+			return
+		}
+
+		p, err := GetPendingMatch(rdb, ctx, request.MatchID)
+		if err == ErrPendingNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		claimed, err := claimPending(rdb, ctx, constants.DisputeQueue, p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			http.Error(w, "Dispute was already resolved", http.StatusConflict)
+			return
+		}
+
+		p.Resolution = request.Note
+		if request.Decision == "void" {
+			p.Status = PendingVoided
+			err = savePending(rdb, ctx, p, PendingRetention)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(Response{Status: true, Result: p})
+			return
+		}
+
+		report := p.Report
+		if request.Score1 != nil {
+			report.Score1 = *request.Score1
+		}
+		if request.Score2 != nil {
+			report.Score2 = *request.Score2
+		}
+
+		m, status, err := applyPending(rdb, ctx, constants.DisputeQueue, p, report, PendingResolved)
+		if err != nil {
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: m})
+	}
+}
+
+// StartConfirmationWorker periodically applies pending matches whose confirmation deadline has passed
+func StartConfirmationWorker(rdb *redis.Client, ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			due, err := rdb.ZRangeByScore(ctx, constants.PendingDeadlines, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().Unix(), 10),
+			}).Result()
+			if err != nil {
+				log.Printf("Confirmation worker: %v", err)
+				continue
+			}
+
+			for _, idStr := range due {
+				id, err := strconv.Atoi(idStr)
+				if err != nil {
+					rdb.ZRem(ctx, constants.PendingDeadlines, idStr)
+					continue
+				}
+
+				p, err := GetPendingMatch(rdb, ctx, id)
+				if err == ErrPendingNotFound {
+					rdb.ZRem(ctx, constants.PendingDeadlines, idStr)
+					continue
+				} else if err != nil {
+					log.Printf("Confirmation worker: match %d: %v", id, err)
+					continue
+				}
+
+				claimed, err := claimPending(rdb, ctx, constants.PendingDeadlines, p)
+				if err != nil || !claimed {
+					continue
+				}
+
+				_, _, err = applyPending(rdb, ctx, constants.PendingDeadlines, p, p.Report, PendingAutoApplied)
+				if err != nil {
+					log.Printf("Confirmation worker: match %d: %v", id, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package match
+
+import (
+	"context"
+	"log"
+
+	"masomointern/internal/events"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/season"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// seasonRanks returns the players' ranks on the running season's leaderboard and the season
+// they were read from. Failures are only logged; the event is published without them.
+func seasonRanks(rdb *redis.Client, ctx context.Context, ids []int) (map[int]int, int) {
+	seasonID, err := season.Current(rdb, ctx)
+	if err != nil {
+		log.Printf("Ranks before match could not be read: %v", err)
+		return nil, 0
+	}
+	ranks, err := leaderboard.Ranks(rdb, ctx, season.Key(seasonID), ids)
+	if err != nil {
+		log.Printf("Ranks before match could not be read: %v", err)
+		return nil, 0
+	}
+	return ranks, seasonID
+}
+
+// matchReported builds the event published once a match is recorded
+func matchReported(m Match, seasonID int, ranksBefore map[int]int) events.MatchReportedData {
+	data := events.MatchReportedData{
+		MatchID:     m.ID,
+		Format:      m.Format,
+		League:      m.League,
+		Season:      seasonID,
+		Players:     make([]events.MatchPlayer, len(m.Players)),
+		RanksBefore: ranksBefore,
+	}
+	for i, p := range m.Players {
+		data.Players[i] = events.MatchPlayer{
+			UserID:    p.UserID,
+			Team:      p.Team,
+			Score:     p.Score,
+			Placement: p.Placement,
+			Points:    p.Points,
+			EloChange: p.EloChange,
+		}
+	}
+	return data
+}
+
+// RegisterEventHandlers subscribes the match package to the events it reacts to
+func RegisterEventHandlers(rdb *redis.Client) {
+	// Canlı sıralama aboneleri tüm sunuculara Pub/Sub ile haber verilerek güncellenir
+	events.Subscribe("live-leaderboard", func(ctx context.Context, e events.Event) error {
+		var data events.MatchReportedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		ids := make([]int, len(data.Players))
+		for i, p := range data.Players {
+			ids[i] = p.UserID
+		}
+		return PublishLeaderboardUpdate(rdb, ctx, ids)
+	}, events.MatchReported)
+}
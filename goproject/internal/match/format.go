@@ -0,0 +1,300 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/scoring"
+	"masomointern/internal/table"
+)
+
+const (
+	FormatDuel       = "1v1"
+	FormatFreeForAll = "ffa"
+	FormatTeam       = "team"
+
+	MaxPlayers = 64
+)
+
+// PlayerReport, çok oyunculu bildirimde bir oyuncunun skoru ve takımı
+type PlayerReport struct {
+	UserID  int    `json:"userid"`
+	Score   int    `json:"score"`
+	Team    string `json:"team,omitempty"`
+	Forfeit bool   `json:"forfeit,omitempty"`
+}
+
+// TeamReport, takım maçında bir takımın skoru
+type TeamReport struct {
+	Name    string `json:"name"`
+	Score   int    `json:"score"`
+	Forfeit bool   `json:"forfeit,omitempty"`
+}
+
+// PlayerResult, bir oyuncunun maçtaki sonucu
+type PlayerResult struct {
+	UserID    int     `json:"userid"`
+	Team      string  `json:"team,omitempty"`
+	Score     int     `json:"score"`
+	Placement int     `json:"placement"`
+	Points    int     `json:"points"`
+	Forfeit   bool    `json:"forfeit,omitempty"`
+	EloChange float64 `json:"elo_change"`
+
+	// GoalDifference, iki taraflı maçlarda kural setinin sınırladığı skor farkı
+	GoalDifference int `json:"goal_difference"`
+}
+
+// TeamResult, bir takımın maçtaki sonucu
+type TeamResult struct {
+	Name      string `json:"name"`
+	Score     int    `json:"score"`
+	Placement int    `json:"placement"`
+	Points    int    `json:"points"`
+	Forfeit   bool   `json:"forfeit,omitempty"`
+}
+
+// players returns the report's players, converting the two-player payload when no list is given
+func (report MatchReport) players() []PlayerReport {
+	if len(report.Players) > 0 {
+		return report.Players
+	}
+	return []PlayerReport{
+		{UserID: report.UserID1, Score: report.Score1, Forfeit: report.Forfeit != 0 && report.Forfeit == report.UserID1},
+		{UserID: report.UserID2, Score: report.Score2, Forfeit: report.Forfeit != 0 && report.Forfeit == report.UserID2},
+	}
+}
+
+// hasParticipant reports whether userID is one of the report's players
+func (report MatchReport) hasParticipant(userID int) bool {
+	for _, p := range report.players() {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// buildMatch checks the shape of a report and computes placements and points for every player
+// with the given rule set
+func buildMatch(report MatchReport, rules scoring.RuleSet) (Match, error) {
+	players := report.players()
+	format := report.Format
+	if format == "" {
+		format = FormatDuel
+		if len(report.Teams) > 0 {
+			format = FormatTeam
+		} else if len(report.Players) > 0 {
+			format = FormatFreeForAll
+		}
+	}
+
+	if len(players) < 2 {
+		return Match{}, errors.New("A match needs at least two players")
+	}
+	if report.Forfeit != 0 && len(report.Players) > 0 {
+		return Match{}, errors.New("Mark forfeits on the players or teams list")
+	}
+	if report.Forfeit != 0 && report.Forfeit != report.UserID1 && report.Forfeit != report.UserID2 {
+		return Match{}, errors.New("Only a participant can forfeit")
+	}
+	if len(players) > MaxPlayers {
+		return Match{}, fmt.Errorf("A match can have at most %d players", MaxPlayers)
+	}
+	seen := make(map[int]bool, len(players))
+	for _, p := range players {
+		if seen[p.UserID] {
+			return Match{}, errors.New("A user cannot play against themselves")
+		}
+		seen[p.UserID] = true
+		if p.Score < 0 {
+			return Match{}, errors.New("Scores cannot be negative")
+		}
+	}
+
+	m := Match{Format: format, League: report.League, Rules: rules.Name, Players: make([]PlayerResult, len(players))}
+
+	switch format {
+	case FormatDuel, FormatFreeForAll:
+		if format == FormatDuel && len(players) != 2 {
+			return Match{}, errors.New("A 1v1 match needs exactly two players")
+		}
+
+		sides := make([]scoring.Side, len(players))
+		for i, p := range players {
+			if p.Team != "" {
+				return Match{}, errors.New("Teams are only allowed in team matches")
+			}
+			sides[i] = scoring.Side{Score: p.Score, Forfeit: p.Forfeit}
+		}
+		results := rules.Score(sides)
+
+		for i, p := range players {
+			m.Players[i] = PlayerResult{
+				UserID:    p.UserID,
+				Score:     results[i].Score,
+				Placement: results[i].Placement,
+				Points:    results[i].Points,
+				Forfeit:   p.Forfeit,
+
+				GoalDifference: results[i].GoalDifference,
+			}
+		}
+
+	case FormatTeam:
+		if len(report.Teams) < 2 {
+			return Match{}, errors.New("A team match needs at least two teams")
+		}
+
+		teamIndex := make(map[string]int, len(report.Teams))
+		sides := make([]scoring.Side, len(report.Teams))
+		for i, t := range report.Teams {
+			if t.Name == "" {
+				return Match{}, errors.New("Team name is required")
+			}
+			if _, ok := teamIndex[t.Name]; ok {
+				return Match{}, fmt.Errorf("Team %s is listed twice", t.Name)
+			}
+			if t.Score < 0 {
+				return Match{}, errors.New("Scores cannot be negative")
+			}
+			teamIndex[t.Name] = i
+			sides[i] = scoring.Side{Score: t.Score, Forfeit: t.Forfeit}
+		}
+
+		members := make([]int, len(report.Teams))
+		for _, p := range players {
+			idx, ok := teamIndex[p.Team]
+			if !ok {
+				return Match{}, fmt.Errorf("User %d has no valid team", p.UserID)
+			}
+			if p.Forfeit {
+				return Match{}, errors.New("In team matches forfeits are marked on the team")
+			}
+			members[idx]++
+		}
+		for i, t := range report.Teams {
+			if members[i] == 0 {
+				return Match{}, fmt.Errorf("Team %s has no players", t.Name)
+			}
+		}
+
+		results := rules.Score(sides)
+		differences := make([]int, len(report.Teams))
+		m.Teams = make([]TeamResult, len(report.Teams))
+		for i, t := range report.Teams {
+			differences[i] = results[i].GoalDifference
+			m.Teams[i] = TeamResult{
+				Name:      t.Name,
+				Score:     results[i].Score,
+				Placement: results[i].Placement,
+				Points:    results[i].Points,
+				Forfeit:   t.Forfeit,
+			}
+		}
+
+		// Takım puanı her oyuncuya yazılır, oyuncunun kendi skoru katkısı olarak saklanır
+		for i, p := range players {
+			idx := teamIndex[p.Team]
+			team := m.Teams[idx]
+			m.Players[i] = PlayerResult{
+				UserID:    p.UserID,
+				Team:      p.Team,
+				Score:     p.Score,
+				Placement: team.Placement,
+				Points:    team.Points,
+				Forfeit:   team.Forfeit,
+
+				GoalDifference: differences[idx],
+			}
+		}
+
+	default:
+		return Match{}, fmt.Errorf("Unknown match format %s", format)
+	}
+
+	// İki oyunculu eski alanlar geriye dönük uyumluluk için doldurulur
+	if format == FormatDuel {
+		m.UserID1, m.Score1, m.Points1 = m.Players[0].UserID, m.Players[0].Score, m.Players[0].Points
+		m.UserID2, m.Score2, m.Points2 = m.Players[1].UserID, m.Players[1].Score, m.Players[1].Points
+	}
+	return m, nil
+}
+
+// outcomes returns each player's W/D/L result and goals for the league table. Goals against are
+// the other side's score, or the best opposing score when more than two sides played.
+func (m Match) outcomes() []table.Outcome {
+	var scores, ranks []int
+	side := make([]int, len(m.Players))
+	if m.Format == FormatTeam {
+		index := make(map[string]int, len(m.Teams))
+		for i, t := range m.Teams {
+			index[t.Name] = i
+			scores = append(scores, t.Score)
+			ranks = append(ranks, t.Placement)
+		}
+		for i, p := range m.Players {
+			side[i] = index[p.Team]
+		}
+	} else {
+		for i, p := range m.Players {
+			side[i] = i
+			scores = append(scores, p.Score)
+			ranks = append(ranks, p.Placement)
+		}
+	}
+
+	winners := 0
+	for _, r := range ranks {
+		if r == 1 {
+			winners++
+		}
+	}
+
+	outcomes := make([]table.Outcome, len(m.Players))
+	for i, p := range m.Players {
+		s := side[i]
+		against := 0
+		for j, score := range scores {
+			if j != s && score > against {
+				against = score
+			}
+		}
+
+		result := table.Loss
+		if ranks[s] == 1 && winners == 1 {
+			result = table.Win
+		} else if ranks[s] == 1 {
+			result = table.Draw
+		}
+		outcomes[i] = table.Outcome{Result: result, GoalsFor: scores[s], GoalsAgainst: against, Points: p.Points}
+	}
+	return outcomes
+}
+
+// leaderboardResult returns the i-th player's entry for the leaderboards. Head-to-head
+// tiebreak data is only kept for 1v1 matches.
+func (m Match) leaderboardResult(i int) leaderboard.Result {
+	p := m.Players[i]
+	result := leaderboard.Result{UserID: p.UserID, Points: float64(p.Points), GoalDifference: p.GoalDifference}
+	if m.Format == FormatDuel {
+		result.Opponents = []int{m.Players[1-i].UserID}
+	}
+	return result
+}
+
+// Preview scores a report with the given rules without recording it and returns the match with
+// each player's leaderboard entry and league table outcome. Simulations use it so their results
+// are derived exactly like reported matches.
+func Preview(report MatchReport, rules scoring.RuleSet) (Match, []leaderboard.Result, []table.Outcome, error) {
+	m, err := buildMatch(report, rules)
+	if err != nil {
+		return Match{}, nil, nil, err
+	}
+	results := make([]leaderboard.Result, len(m.Players))
+	for i := range m.Players {
+		results[i] = m.leaderboardResult(i)
+	}
+	return m, results, m.outcomes(), nil
+}
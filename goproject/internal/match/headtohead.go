@@ -0,0 +1,273 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MaxHeadToHeadMeetings, yanıtta gösterilebilecek en fazla son karşılaşma sayısı
+const MaxHeadToHeadMeetings = 50
+
+// HeadToHeadSide, iki oyuncudan birinin karşılaşmalardaki toplamları
+type HeadToHeadSide struct {
+	UserID       int     `json:"userid"`
+	Username     string  `json:"username"`
+	Wins         int     `json:"wins"`
+	Goals        int     `json:"goals"`
+	RatingChange float64 `json:"rating_change"`
+}
+
+// HeadToHead, iki oyuncu arasındaki karşılaşmaların özeti
+type HeadToHead struct {
+	Played int            `json:"played"`
+	Draws  int            `json:"draws"`
+	User1  HeadToHeadSide `json:"user1"`
+	User2  HeadToHeadSide `json:"user2"`
+	Last   []Match        `json:"last"`
+}
+
+// pairKey returns the index of matches between two players; the smaller ID comes first
+func pairKey(a, b int) string {
+	if a > b {
+		a, b = b, a
+	}
+	return constants.HeadToHeadPrefix + strconv.Itoa(a) + ":" + strconv.Itoa(b)
+}
+
+// standing returns a player's side score and placement in the match
+func (m Match) standing(userID int) (score, placement int, ok bool) {
+	if len(m.Players) == 0 {
+		// Çok oyunculu destekten önceki kayıtlar
+		switch userID {
+		case m.UserID1:
+			return m.Score1, 1 + boolToInt(m.Score2 > m.Score1), true
+		case m.UserID2:
+			return m.Score2, 1 + boolToInt(m.Score1 > m.Score2), true
+		}
+		return 0, 0, false
+	}
+
+	for _, p := range m.Players {
+		if p.UserID != userID {
+			continue
+		}
+		for _, t := range m.Teams {
+			if t.Name == p.Team {
+				return t.Score, p.Placement, true
+			}
+		}
+		return p.Score, p.Placement, true
+	}
+	return 0, 0, false
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// eloChange returns a player's rating change in the match
+func (m Match) eloChange(userID int) float64 {
+	for _, p := range m.Players {
+		if p.UserID == userID {
+			return p.EloChange
+		}
+	}
+	if userID == m.UserID1 {
+		return m.EloChange1
+	} else if userID == m.UserID2 {
+		return m.EloChange2
+	}
+	return 0
+}
+
+// opponentPairs lists every pair of players who played against each other; teammates are not opponents
+func (m Match) opponentPairs() [][2]int {
+	ids := m.participantIDs()
+	teams := make(map[int]string, len(m.Players))
+	for _, p := range m.Players {
+		teams[p.UserID] = p.Team
+	}
+
+	var pairs [][2]int
+	for i := 0; i < len(ids); i++ {
+		for j := i + 1; j < len(ids); j++ {
+			if teams[ids[i]] != "" && teams[ids[i]] == teams[ids[j]] {
+				continue
+			}
+			pairs = append(pairs, [2]int{ids[i], ids[j]})
+		}
+	}
+	return pairs
+}
+
+// queueHeadToHead indexes the match under every pair of opponents
+func queueHeadToHead(pipe redis.Pipeliner, ctx context.Context, m Match, at time.Time) {
+	member := strconv.Itoa(m.ID)
+	for _, pair := range m.opponentPairs() {
+		pipe.ZAdd(ctx, pairKey(pair[0], pair[1]), &redis.Z{Score: float64(at.Unix()), Member: member})
+		pipe.SAdd(ctx, constants.OpponentsPrefix+strconv.Itoa(pair[0]), pair[1])
+		pipe.SAdd(ctx, constants.OpponentsPrefix+strconv.Itoa(pair[1]), pair[0])
+	}
+}
+
+// RebuildHeadToHeadIndex indexes matches recorded before the head-to-head index existed. It runs once.
+func RebuildHeadToHeadIndex(rdb *redis.Client, ctx context.Context) error {
+	built, err := rdb.Exists(ctx, constants.HeadToHeadIndexBuilt).Result()
+	if err != nil || built > 0 {
+		return err
+	}
+
+	iter := rdb.Scan(ctx, 0, constants.MatchPrefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		matchJSON, err := rdb.Get(ctx, iter.Val()).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var m Match
+		if json.Unmarshal([]byte(matchJSON), &m) != nil {
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, m.CreatedAt)
+		if err != nil {
+			at = time.Unix(0, 0)
+		}
+		_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			queueHeadToHead(pipe, ctx, m, at)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return rdb.Set(ctx, constants.HeadToHeadIndexBuilt, time.Now().Format(time.RFC3339), 0).Err()
+}
+
+// GetHeadToHead summarises all matches between two players; last limits the meetings returned
+func GetHeadToHead(rdb *redis.Client, ctx context.Context, userID1, userID2, last int) (HeadToHead, error) {
+	h := HeadToHead{
+		User1: HeadToHeadSide{UserID: userID1},
+		User2: HeadToHeadSide{UserID: userID2},
+		Last:  []Match{},
+	}
+
+	// Yalnızca bu iki oyuncunun maçları okunur, en yenisi başta
+	ids, err := rdb.ZRevRange(ctx, pairKey(userID1, userID2), 0, -1).Result()
+	if err != nil {
+		return h, err
+	}
+
+	for offset := 0; offset < len(ids); offset += historyScanBatch {
+		end := offset + historyScanBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, err := getMatches(rdb, ctx, ids[offset:end])
+		if err != nil {
+			return h, err
+		}
+
+		for _, m := range batch {
+			score1, placement1, ok1 := m.standing(userID1)
+			score2, placement2, ok2 := m.standing(userID2)
+			if !ok1 || !ok2 {
+				continue
+			}
+
+			h.Played++
+			h.User1.Goals += score1
+			h.User2.Goals += score2
+			h.User1.RatingChange += m.eloChange(userID1)
+			h.User2.RatingChange += m.eloChange(userID2)
+			if placement1 < placement2 {
+				h.User1.Wins++
+			} else if placement2 < placement1 {
+				h.User2.Wins++
+			} else {
+				h.Draws++
+			}
+
+			if len(h.Last) < last {
+				h.Last = append(h.Last, m)
+			}
+		}
+	}
+	return h, nil
+}
+
+// HeadToHeadHandler returns the record between two players. user1 defaults to the caller;
+// last sets how many recent meetings are included (default 5).
+func HeadToHeadHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		userID1, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if query.Get("user1") != "" {
+			userID1, err = strconv.Atoi(query.Get("user1"))
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+		}
+		userID2, err := strconv.Atoi(query.Get("user2"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if userID1 == userID2 {
+			http.Error(w, "Two different users are required", http.StatusBadRequest)
+			return
+		}
+
+		last, err := strconv.Atoi(query.Get("last"))
+		if err != nil || last < 0 {
+			last = 5
+		}
+		if last > MaxHeadToHeadMeetings {
+			last = MaxHeadToHeadMeetings
+		}
+
+		profiles, err := user.GetUsersByIDs(rdb, ctx, []int{userID1, userID2})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, id := range []int{userID1, userID2} {
+			if u, ok := profiles[id]; !ok || u.DeletedAt != "" {
+				http.Error(w, user.ErrUserNotFound.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		h, err := GetHeadToHead(rdb, ctx, userID1, userID2, last)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.User1.Username = profiles[userID1].Username
+		h.User2.Username = profiles[userID2].Username
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: h})
+	}
+}
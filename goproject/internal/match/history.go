@@ -0,0 +1,369 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/events"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/rating"
+	"masomointern/internal/season"
+	"masomointern/internal/table"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// historyScanBatch, karşılaşma özetinde bir seferde okunan maç sayısı
+	historyScanBatch = 100
+
+	// MaxHistoryCount, maç geçmişinde bir sayfada döndürülebilecek en fazla maç
+	MaxHistoryCount = 100
+)
+
+// ErrMatchNotFound is returned when no match:<id> record exists
+var ErrMatchNotFound = errors.New("Match not found")
+
+// Match, raporlanmış bir maçın kalıcı kaydı
+type Match struct {
+	ID         int     `json:"id"`
+	UserID1    int     `json:"userid1"`
+	UserID2    int     `json:"userid2"`
+	Score1     int     `json:"score1"`
+	Score2     int     `json:"score2"`
+	Points1    int     `json:"points1"`
+	Points2    int     `json:"points2"`
+	EloChange1 float64 `json:"elo_change1"`
+	EloChange2 float64 `json:"elo_change2"`
+	CreatedAt  string  `json:"created_at"`
+
+	Format  string         `json:"format,omitempty"`
+	League  string         `json:"league,omitempty"`
+	Rules   string         `json:"rules,omitempty"`
+	Players []PlayerResult `json:"players,omitempty"`
+	Teams   []TeamResult   `json:"teams,omitempty"`
+}
+
+// participantIDs returns the IDs of every player; matches stored before
+// multi-player support only have the two-player fields
+func (m Match) participantIDs() []int {
+	if len(m.Players) == 0 {
+		return []int{m.UserID1, m.UserID2}
+	}
+	ids := make([]int, len(m.Players))
+	for i, p := range m.Players {
+		ids[i] = p.UserID
+	}
+	return ids
+}
+
+// HistoryFilter narrows a user's match history
+type HistoryFilter struct {
+	OpponentID int       // 0 ise tüm rakipler
+	From       time.Time // Sıfır değer ise alt sınır yok
+	To         time.Time // Sıfır değer ise üst sınır yok
+}
+
+// NewMatchID reserves the next match ID
+func NewMatchID(rdb *redis.Client, ctx context.Context) (int, error) {
+	id, err := rdb.Incr(ctx, constants.NextMatchID).Result()
+	return int(id), err
+}
+
+// recordRetries, WATCH çakışmasında maç kaydının kaç kez deneneceği
+const recordRetries = 5
+
+// queueMatch adds the match record, every participant's history entry and the head-to-head index to a pipeline
+func queueMatch(pipe redis.Pipeliner, ctx context.Context, m Match, at time.Time) error {
+	matchJSON, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	matchID := strconv.Itoa(m.ID)
+	pipe.Set(ctx, constants.MatchPrefix+matchID, matchJSON, 0)
+	for _, id := range m.participantIDs() {
+		pipe.ZAdd(ctx, constants.UserMatchesPrefix+strconv.Itoa(id), &redis.Z{Score: float64(at.Unix()), Member: matchID})
+	}
+	queueHeadToHead(pipe, ctx, m, at)
+	return nil
+}
+
+// RecordMatch assigns an ID to the match if it has none and writes its leaderboard points,
+// league table stats, the match record, history entries, rating changes and the match.reported
+// event in a single transaction
+func RecordMatch(rdb *redis.Client, ctx context.Context, m *Match) error {
+	if m.ID == 0 {
+		id, err := NewMatchID(rdb, ctx)
+		if err != nil {
+			return err
+		}
+		m.ID = id
+	}
+
+	participants := make([]rating.Participant, len(m.Players))
+	ids := make([]int, len(m.Players))
+	for i, p := range m.Players {
+		participants[i] = rating.Participant{UserID: p.UserID, Team: p.Team, Placement: p.Placement}
+		ids[i] = p.UserID
+	}
+
+	outcomes := m.outcomes()
+
+	// Sıra değişikliği bildirimleri için oyuncuların maç öncesi sıraları olayla birlikte gönderilir
+	ranksBefore, ranksSeason := seasonRanks(rdb, ctx, ids)
+
+	record := func(seasonID int) func(tx *redis.Tx) error {
+		return func(tx *redis.Tx) error {
+			// Sezon, WATCH öncesi okunduktan sonra değişmişse yeniden denenir
+			current, err := season.Current(tx, ctx)
+			if err != nil {
+				return err
+			}
+			if current != seasonID {
+				return redis.TxFailedErr
+			}
+			board := season.Key(seasonID)
+
+			update, err := rating.PrepareMatch(tx, ctx, m.ID, participants)
+			if err != nil {
+				return err
+			}
+			rows := make([]table.Row, len(m.Players))
+			for i, p := range m.Players {
+				row, err := table.Get(tx, ctx, seasonID, p.UserID)
+				if err != nil {
+					return err
+				}
+				rows[i] = row.Apply(outcomes[i])
+			}
+
+			now := time.Now()
+			for i := range m.Players {
+				m.Players[i].EloChange = update.Changes[m.Players[i].UserID]
+			}
+			if m.Format == FormatDuel {
+				m.EloChange1 = m.Players[0].EloChange
+				m.EloChange2 = m.Players[1].EloChange
+			}
+			m.CreatedAt = now.Format(time.RFC3339)
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := range m.Players {
+					leaderboard.QueueResult(pipe, ctx, board, m.leaderboardResult(i), now)
+					table.Queue(pipe, ctx, seasonID, rows[i])
+				}
+
+				err := queueMatch(pipe, ctx, *m, now)
+				if err != nil {
+					return err
+				}
+				err = update.Queue(pipe, ctx)
+				if err != nil {
+					return err
+				}
+
+				// Olay, maçla aynı MULTI içinde yazılır; maç kaydedildiyse olay da kaybolmaz
+				ranks := ranksBefore
+				if seasonID != ranksSeason {
+					ranks = nil
+				}
+				return events.QueuePublish(pipe, ctx, events.MatchReported, matchReported(*m, seasonID, ranks))
+			})
+			return err
+		}
+	}
+
+	for i := 0; i < recordRetries; i++ {
+		seasonID, err := season.Current(rdb, ctx)
+		if err != nil {
+			return err
+		}
+
+		// Sezon geçişiyle çakışan maç yeni sezona yazılmak üzere tekrar denenir
+		keys := append(rating.WatchKeys(ids...), table.WatchKeys(seasonID, ids...)...)
+		err = rdb.Watch(ctx, record(seasonID), append(keys, constants.CurrentSeason)...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.New("Match could not be recorded: too many concurrent changes")
+}
+
+// GetMatch loads a single match by ID
+func GetMatch(rdb *redis.Client, ctx context.Context, id int) (Match, error) {
+	matchJSON, err := rdb.Get(ctx, constants.MatchPrefix+strconv.Itoa(id)).Result()
+	if err == redis.Nil {
+		return Match{}, ErrMatchNotFound
+	} else if err != nil {
+		return Match{}, err
+	}
+
+	var m Match
+	err = json.Unmarshal([]byte(matchJSON), &m)
+	return m, err
+}
+
+func getMatches(rdb *redis.Client, ctx context.Context, ids []string) ([]Match, error) {
+	if len(ids) == 0 {
+		return []Match{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = constants.MatchPrefix + id
+	}
+
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, 0, len(values))
+	for _, value := range values {
+		matchJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var m Match
+		err = json.Unmarshal([]byte(matchJSON), &m)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
+
+// GetUserMatches returns the user's matches newest first, applying the filter before pagination
+func GetUserMatches(rdb *redis.Client, ctx context.Context, userID int, filter HistoryFilter, offset, count int) ([]Match, error) {
+	rangeBy := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !filter.From.IsZero() {
+		rangeBy.Min = strconv.FormatInt(filter.From.Unix(), 10)
+	}
+	if !filter.To.IsZero() {
+		rangeBy.Max = strconv.FormatInt(filter.To.Unix(), 10)
+	}
+	key := constants.UserMatchesPrefix + strconv.Itoa(userID)
+	// Rakip filtresinde iki oyuncunun karşılaşma indeksi okunur, sayfalamayı yine Redis yapar
+	if filter.OpponentID != 0 {
+		key = pairKey(userID, filter.OpponentID)
+	}
+
+	rangeBy.Offset = int64(offset)
+	rangeBy.Count = int64(count)
+	ids, err := rdb.ZRevRangeByScore(ctx, key, &rangeBy).Result()
+	if err != nil {
+		return nil, err
+	}
+	return getMatches(rdb, ctx, ids)
+}
+
+// MatchHandler returns a single match by ID
+func MatchHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid match ID", http.StatusBadRequest)
+			return
+		}
+
+		m, err := GetMatch(rdb, ctx, id)
+		if err == ErrMatchNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: m})
+	}
+}
+
+// MatchHistoryHandler pages through a user's matches, newest first.
+// userid defaults to the caller; opponent, from and to (RFC3339 or YYYY-MM-DD) are optional filters.
+// opponent keeps matches where the player was on the other side; teammates do not count.
+func MatchHistoryHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if query.Get("userid") != "" {
+			userID, err = strconv.Atoi(query.Get("userid"))
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var filter HistoryFilter
+		if query.Get("opponent") != "" {
+			filter.OpponentID, err = strconv.Atoi(query.Get("opponent"))
+			if err != nil || filter.OpponentID == userID {
+				http.Error(w, "Invalid opponent ID", http.StatusBadRequest)
+				return
+			}
+		}
+		filter.From, err = parseDate(query.Get("from"), false)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		filter.To, err = parseDate(query.Get("to"), true)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		count, err := strconv.Atoi(query.Get("count"))
+		if err != nil || count < 1 {
+			count = 10
+		}
+		if count > MaxHistoryCount {
+			count = MaxHistoryCount
+		}
+
+		matches, err := GetUserMatches(rdb, ctx, userID, filter, (page-1)*count, count)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: matches})
+	}
+}
+
+// parseDate accepts RFC3339 or YYYY-MM-DD; a bare date used as an upper bound covers the whole day
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
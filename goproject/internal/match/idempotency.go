@@ -0,0 +1,221 @@
+package match
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	// IdempotencyWindow, ilk yanıtın tekrar denemeler için saklandığı süre
+	IdempotencyWindow = 24 * time.Hour
+
+	// IdempotencyPendingTTL, işlenmekte olan isteğin anahtarı tuttuğu süre. İstek sürdükçe
+	// yenilenir; sunucu yanıtı saklayamadan çökerse tekrar denemeler bu süreden sonra işlenir.
+	IdempotencyPendingTTL = time.Minute
+)
+
+// releaseScript, anahtarı yalnızca hâlâ bu isteğin yer tutucusuysa siler
+var releaseScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// refreshScript, yer tutucunun süresini yalnızca hâlâ bu isteğe aitse uzatır
+var refreshScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+const (
+	idempotencyPending = "pending"
+	idempotencyDone    = "done"
+)
+
+var (
+	ErrIdempotencyConflict   = errors.New("Idempotency key was already used with a different payload")
+	ErrIdempotencyInProgress = errors.New("A request with this idempotency key is still in progress")
+)
+
+// idempotencyRecord, bir idempotency anahtarı altında saklanan istek özeti ve yanıt
+type idempotencyRecord struct {
+	Hash   string `json:"hash"`
+	State  string `json:"state"`
+	Token  string `json:"token,omitempty"` // Yer tutucuyu alan isteğe özgü
+	Code   int    `json:"code,omitempty"`
+	Body   []byte `json:"body,omitempty"`
+	Stored string `json:"stored,omitempty"`
+}
+
+// idempotencyKeys builds the Redis keys a request must claim. The Idempotency-Key header is
+// scoped to the caller; a client-supplied match ID is global so both participants share it, and
+// it is claimed as well when a header is sent.
+func idempotencyKeys(rdb *redis.Client, ctx context.Context, r *http.Request, report MatchReport) ([]string, error) {
+	var keys []string
+	if header := r.Header.Get("Idempotency-Key"); header != "" {
+		scope := "service"
+		if !authent.IsServiceRequest(r) {
+			callerID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+			if err != nil {
+				return nil, err
+			}
+			scope = strconv.Itoa(callerID)
+		}
+		keys = append(keys, constants.IdempotencyPrefix+scope+":"+header)
+	}
+	if report.ClientMatchID != "" {
+		keys = append(keys, constants.IdempotencyPrefix+"match:"+report.ClientMatchID)
+	}
+	return keys, nil
+}
+
+func payloadHash(report MatchReport) (string, error) {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// idempotencyClaim, bir isteğin yer tutucusunu yazdığı anahtarlar
+type idempotencyClaim struct {
+	keys  []string
+	hash  string
+	token string
+	done  chan struct{}
+}
+
+// beginIdempotent claims every key for this request with a placeholder carrying a token of
+// its own. If a key was already completed with the same payload, its stored record is returned
+// so the response can be replayed; keys claimed before that are released again.
+func beginIdempotent(rdb *redis.Client, ctx context.Context, keys []string, hash string) (*idempotencyClaim, *idempotencyRecord, error) {
+	claim := &idempotencyClaim{hash: hash, token: uuid.New().String(), done: make(chan struct{})}
+	pending, err := json.Marshal(idempotencyRecord{Hash: hash, State: idempotencyPending, Token: claim.token})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		record, err := claimKey(rdb, ctx, key, hash, pending)
+		if err != nil || record != nil {
+			claim.release(rdb, ctx)
+			return nil, record, err
+		}
+		claim.keys = append(claim.keys, key)
+	}
+	go claim.keepAlive(rdb, ctx)
+	return claim, nil, nil
+}
+
+// claimKey writes the placeholder under a single key. It returns the stored record if the key
+// was already completed with the same payload.
+func claimKey(rdb *redis.Client, ctx context.Context, key, hash string, pending []byte) (*idempotencyRecord, error) {
+	claimed, err := rdb.SetNX(ctx, key, pending, IdempotencyPendingTTL).Result()
+	if err != nil || claimed {
+		return nil, err
+	}
+
+	recordJSON, err := rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Anahtar bu arada süresi dolup silinmiş, yeniden deniyoruz
+		return claimKey(rdb, ctx, key, hash, pending)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var record idempotencyRecord
+	err = json.Unmarshal([]byte(recordJSON), &record)
+	if err != nil {
+		return nil, err
+	}
+	if record.Hash != hash {
+		return nil, ErrIdempotencyConflict
+	}
+	if record.State != idempotencyDone {
+		return nil, ErrIdempotencyInProgress
+	}
+	return &record, nil
+}
+
+// keepAlive extends the placeholders while the request runs, so a slow request does not lose
+// its keys to a retry
+func (c *idempotencyClaim) keepAlive(rdb *redis.Client, ctx context.Context) {
+	ticker := time.NewTicker(IdempotencyPendingTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			for _, key := range c.keys {
+				err := refreshScript.Run(ctx, rdb, []string{key}, c.token, IdempotencyPendingTTL.Milliseconds()).Err()
+				if err != nil && err != redis.Nil {
+					log.Printf("Idempotency key %s could not be refreshed: %v", key, err)
+				}
+			}
+		}
+	}
+}
+
+// stop ends the placeholder refresh; it is safe to call more than once
+func (c *idempotencyClaim) stop() {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
+
+// finish stores the response that will be replayed for retries for the full window
+func (c *idempotencyClaim) finish(rdb *redis.Client, ctx context.Context, code int, body []byte) error {
+	c.stop()
+	recordJSON, err := json.Marshal(idempotencyRecord{
+		Hash:   c.hash,
+		State:  idempotencyDone,
+		Code:   code,
+		Body:   body,
+		Stored: time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.keys {
+			pipe.Set(ctx, key, recordJSON, IdempotencyWindow)
+		}
+		return nil
+	})
+	return err
+}
+
+// release frees the keys after a failed request so the client can retry it. Only placeholders
+// still holding this request's token are deleted; a key that has passed to another request
+// is left alone.
+func (c *idempotencyClaim) release(rdb *redis.Client, ctx context.Context) {
+	c.stop()
+	for _, key := range c.keys {
+		err := releaseScript.Run(ctx, rdb, []string{key}, c.token).Err()
+		if err != nil && err != redis.Nil {
+			log.Printf("Idempotency key %s could not be released: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"masomointern/internal/constants"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/season"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ölçüm ayarları; tohumlanan veritabanı her çalıştırmada boşaltılır
+const (
+	benchDB       = 15
+	benchPlayers  = 100000
+	benchPageSize = 100
+	benchMissing  = 0.01 // Kullanıcı kaydı olmayan (silinmiş) oyuncu oranı
+)
+
+// roundTrips, Redis'e yapılan gidiş-dönüşleri sayar; bir pipeline tek gidiş-dönüş sayılır
+type roundTrips struct {
+	count int64
+}
+
+func (h *roundTrips) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *roundTrips) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	atomic.AddInt64(&h.count, 1)
+	return nil
+}
+
+func (h *roundTrips) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *roundTrips) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	atomic.AddInt64(&h.count, 1)
+	return nil
+}
+
+// seedLeaderboard writes benchPlayers users and their season scores in batches. A fraction of
+// the users get no user record so the handling of deleted accounts is exercised.
+func seedLeaderboard(rdb *redis.Client, ctx context.Context) error {
+	const batch = 5000
+	board := season.Key(1)
+	// Skor aralığı dar tutulur; böylece eşit puanlı gruplar ve eşitlik bozucular da ölçülür
+	spread := benchPlayers/10 + 1
+
+	for from := 1; from <= benchPlayers; from += batch {
+		_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for id := from; id < from+batch && id <= benchPlayers; id++ {
+				member := strconv.Itoa(id)
+				pipe.ZAdd(ctx, board, &redis.Z{Score: float64(rand.Intn(spread)), Member: member})
+				if rand.Float64() < benchMissing {
+					continue
+				}
+				userJSON, err := json.Marshal(user.User{ID: id, Username: "player" + member})
+				if err != nil {
+					return err
+				}
+				pipe.Set(ctx, constants.UserPrefix+member, userJSON, 0)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rdb.Set(ctx, constants.CurrentSeason, 1, 0).Err()
+}
+
+// BenchmarkLeaderboardHandler measures random leaderboard pages on a large board, without
+// caches, with the public profile cache and with the page cache as well. It needs a scratch
+// Redis given by BENCH_REDIS_ADDR; database 15 of that server is flushed.
+//
+//	BENCH_REDIS_ADDR=localhost:6379 go test ./internal/match -run '^$' -bench LeaderboardHandler
+func BenchmarkLeaderboardHandler(b *testing.B) {
+	addr := os.Getenv("BENCH_REDIS_ADDR")
+	if addr == "" {
+		b.Skip("BENCH_REDIS_ADDR is not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: benchDB})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	if err := rdb.FlushDB(ctx).Err(); err != nil {
+		b.Fatal(err)
+	}
+	if err := seedLeaderboard(rdb, ctx); err != nil {
+		b.Fatal(err)
+	}
+	hook := &roundTrips{}
+	rdb.AddHook(hook)
+	handler := LeaderboardHandler(rdb, ctx)
+
+	profileTTL, pages := user.ProfileCacheTTL, leaderboard.Pages
+	defer func() { user.ProfileCacheTTL, leaderboard.Pages = profileTTL, pages }()
+
+	runs := []struct {
+		name         string
+		profileCache bool
+		pageCache    bool
+	}{
+		{"no cache", false, false},
+		{"profile cache", true, false},
+		{"profile and page cache", true, true},
+	}
+	for _, run := range runs {
+		b.Run(run.name, func(b *testing.B) {
+			user.ProfileCacheTTL = 0
+			if run.profileCache {
+				user.ProfileCacheTTL = profileTTL
+			}
+			leaderboard.Pages = leaderboard.NewPageCache(0, 0)
+			if run.pageCache {
+				leaderboard.Pages = pages
+			}
+
+			// Tüm alt ölçümler aynı sayfa sırasını kullanır
+			random := rand.New(rand.NewSource(1))
+			count := (benchPlayers + benchPageSize - 1) / benchPageSize
+			atomic.StoreInt64(&hook.count, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				url := fmt.Sprintf("/leaderboard?page=%d&count=%d", random.Intn(count)+1, benchPageSize)
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+				if rec.Code != http.StatusOK {
+					b.Fatalf("%s returned %d: %s", url, rec.Code, rec.Body.String())
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&hook.count))/float64(b.N), "roundtrips/op")
+		})
+	}
+}
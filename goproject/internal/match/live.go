@@ -0,0 +1,364 @@
+package match
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/websocket"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ViewTop = "top" // Sıralamanın ilk N oyuncusu
+	ViewMe  = "me"  // Oyuncunun sırası ve çevresindekiler
+
+	// MaxLiveTopCount, canlı ilk N görünümünde izlenebilecek en fazla oyuncu
+	MaxLiveTopCount = 100
+)
+
+var (
+	// LiveUpdateInterval, Pub/Sub bildirimlerinin birleştirilip abonelere gönderildiği aralık
+	LiveUpdateInterval = time.Second
+
+	livePingInterval = 30 * time.Second
+	liveReadTimeout  = 75 * time.Second // Ping aralığından uzun olmalı
+	liveWriteTimeout = 10 * time.Second
+	liveSendBuffer   = 16
+)
+
+// LiveSubscription, bir WebSocket bağlantısının izlediği sıralama görünümü
+type LiveSubscription struct {
+	View    string `json:"view"`
+	Count   int    `json:"count,omitempty"`  // top görünümü için
+	Window  int    `json:"window,omitempty"` // me görünümü için
+	Period  string `json:"period,omitempty"`
+	Season  int    `json:"season,omitempty"`
+	Ranking string `json:"ranking,omitempty"`
+}
+
+// query returns the subscription's board selection in the form boardKey and rankingMode read
+func (s LiveSubscription) query() url.Values {
+	query := url.Values{}
+	if s.Period != "" {
+		query.Set("period", s.Period)
+	}
+	if s.Season > 0 {
+		query.Set("season", strconv.Itoa(s.Season))
+	}
+	if s.Ranking != "" {
+		query.Set("ranking", s.Ranking)
+	}
+	return query
+}
+
+// normalize validates the view and fills in default sizes
+func (s *LiveSubscription) normalize() error {
+	switch s.View {
+	case ViewTop:
+		if s.Count < 1 {
+			s.Count = 10
+		}
+		if s.Count > MaxLiveTopCount {
+			s.Count = MaxLiveTopCount
+		}
+	case ViewMe:
+		if s.Window < 0 {
+			s.Window = 5
+		}
+		if s.Window > MaxRankWindow {
+			s.Window = MaxRankWindow
+		}
+	default:
+		return errors.New("View must be top or me")
+	}
+	_, err := rankingMode(s.query())
+	return err
+}
+
+// liveClient, canlı sıralamaya bağlı bir oyuncu
+type liveClient struct {
+	userID int
+	conn   *websocket.Conn
+	send   chan []byte
+	done   chan struct{}
+
+	// kick, yetişemeyen istemcinin bağlantısını yazma döngüsüne kapattırır
+	kick     chan struct{}
+	kickOnce sync.Once
+
+	mu   sync.Mutex
+	sub  *LiveSubscription // Abone olunana kadar nil
+	last []byte            // Son gönderilen görünüm; değişmeyen görünüm tekrar gönderilmez
+}
+
+// push queues a message without blocking; a client that cannot keep up is disconnected by
+// its write loop
+func (c *liveClient) push(message []byte) {
+	select {
+	case c.send <- message:
+	default:
+		c.kickOnce.Do(func() { close(c.kick) })
+	}
+}
+
+// writeLoop sends queued messages and keeps the connection alive with pings
+func (c *liveClient) writeLoop() {
+	ticker := time.NewTicker(livePingInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case message := <-c.send:
+			err = c.conn.WriteText(message)
+		case <-ticker.C:
+			err = c.conn.Ping()
+		case <-c.kick:
+			c.conn.Close()
+			return
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// liveHub, bu sunucudaki canlı sıralama bağlantıları
+var liveHub = struct {
+	sync.Mutex
+	clients map[*liveClient]struct{}
+}{clients: make(map[*liveClient]struct{})}
+
+func registerLive(c *liveClient) {
+	liveHub.Lock()
+	liveHub.clients[c] = struct{}{}
+	liveHub.Unlock()
+}
+
+func unregisterLive(c *liveClient) {
+	liveHub.Lock()
+	delete(liveHub.clients, c)
+	liveHub.Unlock()
+}
+
+// liveView renders the current state of a subscription
+func liveView(rdb *redis.Client, ctx context.Context, userID int, sub LiveSubscription) ([]byte, error) {
+	query := sub.query()
+	key, _, err := boardKey(rdb, ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := rankingMode(query)
+	if err != nil {
+		return nil, err
+	}
+
+	message := map[string]interface{}{"type": sub.View}
+	switch sub.View {
+	case ViewTop:
+		ranked, err := leaderboard.Page(rdb, ctx, key, key, 0, sub.Count, mode)
+		if err != nil {
+			return nil, err
+		}
+		message["entries"], err = rankedEntries(rdb, ctx, ranked)
+		if err != nil {
+			return nil, err
+		}
+	case ViewMe:
+		rank, score, entries, err := aroundUser(rdb, ctx, key, mode, userID, sub.Window)
+		if err == redis.Nil {
+			// Henüz sıralamada olmayan oyuncu ilk maçından sonra görünür
+			message["ranked"] = false
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		message["ranked"] = true
+		message["rank"] = rank
+		message["score"] = score
+		message["entries"] = entries
+	}
+	return json.Marshal(message)
+}
+
+// refresh renders the subscription of a client and pushes it if it changed. views caches the
+// rendered top views of one refresh round, which are the same for every subscriber.
+func (c *liveClient) refresh(rdb *redis.Client, ctx context.Context, views map[LiveSubscription][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sub == nil {
+		return
+	}
+
+	view, ok := views[*c.sub]
+	if !ok {
+		var err error
+		view, err = liveView(rdb, ctx, c.userID, *c.sub)
+		if err != nil {
+			log.Printf("Live leaderboard view failed for user %d: %v", c.userID, err)
+			return
+		}
+		if c.sub.View == ViewTop {
+			views[*c.sub] = view
+		}
+	}
+
+	if bytes.Equal(view, c.last) {
+		return
+	}
+	c.last = view
+	c.push(view)
+}
+
+// subscribe replaces the client's subscription and sends its current state
+func (c *liveClient) subscribe(rdb *redis.Client, ctx context.Context, sub LiveSubscription) {
+	if err := sub.normalize(); err != nil {
+		c.sendError(err)
+		return
+	}
+	view, err := liveView(rdb, ctx, c.userID, sub)
+	if err != nil {
+		c.sendError(err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sub = &sub
+	c.last = view
+	c.push(view)
+}
+
+func (c *liveClient) sendError(err error) {
+	message, _ := json.Marshal(map[string]string{"type": "error", "message": err.Error()})
+	c.push(message)
+}
+
+// PublishLeaderboardUpdate tells every server instance that the scores of the given players changed
+func PublishLeaderboardUpdate(rdb *redis.Client, ctx context.Context, userIDs []int) error {
+	message, err := json.Marshal(map[string]interface{}{"users": userIDs})
+	if err != nil {
+		return err
+	}
+	return rdb.Publish(ctx, constants.LeaderboardUpdates, message).Err()
+}
+
+// StartLiveUpdates listens for leaderboard updates from all server instances and refreshes
+// the live subscribers of this one. Updates arriving within LiveUpdateInterval are sent together.
+func StartLiveUpdates(rdb *redis.Client, ctx context.Context) {
+	go func() {
+		pubsub := rdb.Subscribe(ctx, constants.LeaderboardUpdates)
+		defer pubsub.Close()
+		updates := pubsub.Channel()
+
+		ticker := time.NewTicker(LiveUpdateInterval)
+		defer ticker.Stop()
+
+		dirty := false
+		for {
+			select {
+			case _, ok := <-updates:
+				if !ok {
+					return
+				}
+				dirty = true
+			case <-ticker.C:
+				if !dirty {
+					continue
+				}
+				dirty = false
+
+				liveHub.Lock()
+				clients := make([]*liveClient, 0, len(liveHub.clients))
+				for c := range liveHub.clients {
+					clients = append(clients, c)
+				}
+				liveHub.Unlock()
+
+				views := map[LiveSubscription][]byte{}
+				for _, c := range clients {
+					c.refresh(rdb, ctx, views)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// LiveLeaderboardHandler upgrades the request to a WebSocket that pushes leaderboard changes.
+// Browsers cannot set headers on a WebSocket, so the connection is authenticated with a ticket
+// from /stream/ticket passed as the ticket query parameter, or with the usual bearer token.
+// Clients choose what to follow by sending a subscription such as {"view":"top","count":10}
+// or {"view":"me","window":5}, optionally with period, season and ranking; the same fields may
+// be given as query parameters to subscribe on connect. Each subscription replaces the previous one.
+func LiveLeaderboardHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetStreamUserID(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.ReadTimeout = liveReadTimeout
+		conn.WriteTimeout = liveWriteTimeout
+
+		c := &liveClient{
+			userID: userID,
+			conn:   conn,
+			send:   make(chan []byte, liveSendBuffer),
+			done:   make(chan struct{}),
+			kick:   make(chan struct{}),
+		}
+		go c.writeLoop()
+		registerLive(c)
+		defer func() {
+			unregisterLive(c)
+			close(c.done)
+			conn.Close()
+		}()
+
+		query := r.URL.Query()
+		if view := query.Get("view"); view != "" {
+			sub := LiveSubscription{View: view, Period: query.Get("period"), Ranking: query.Get("ranking")}
+			sub.Count, _ = strconv.Atoi(query.Get("count"))
+			sub.Season, _ = strconv.Atoi(query.Get("season"))
+			sub.Window = -1
+			if window, err := strconv.Atoi(query.Get("window")); err == nil {
+				sub.Window = window
+			}
+			c.subscribe(rdb, ctx, sub)
+		}
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			sub := LiveSubscription{Window: -1}
+			if err := json.Unmarshal(message, &sub); err != nil {
+				c.sendError(err)
+				continue
+			}
+			c.subscribe(rdb, ctx, sub)
+		}
+	}
+}
@@ -1,13 +1,19 @@
 package match
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"masomointern/internal/constants"
+	"log"
+	"masomointern/internal/authent"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/scoring"
 	"masomointern/internal/user"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -18,14 +24,67 @@ type Response struct {
 	Message string      `json:"message"`
 }
 
-type connection struct {
-	RDB *redis.Client
-	CTX context.Context
+// MatchReport, maç sonucu bildiriminin gövdesi. İki oyunculu maçlar userid1/userid2
+// alanlarıyla, çok oyunculu ve takım maçları players/teams listeleriyle bildirilir.
+type MatchReport struct {
+	UserID1 int `json:"userid1,omitempty"`
+	UserID2 int `json:"userid2,omitempty"`
+	Score1  int `json:"score1,omitempty"`
+	Score2  int `json:"score2,omitempty"`
+
+	Format  string         `json:"format,omitempty"`
+	Players []PlayerReport `json:"players,omitempty"`
+	Teams   []TeamReport   `json:"teams,omitempty"`
+
+	// Forfeit, iki oyunculu bildirimde hükmen kaybeden oyuncunun ID'si
+	Forfeit int `json:"forfeit,omitempty"`
+
+	// League, puanlama kurallarının seçildiği lig; boşsa varsayılan kurallar geçerli
+	League string `json:"league,omitempty"`
+
+	// ClientMatchID, istemcinin verdiği benzersiz maç kimliği; tekrar denemelerde aynı kalmalı
+	ClientMatchID string `json:"match_id,omitempty"`
+
+	// Confirm, sonucun rakip onayından sonra uygulanmasını ister
+	Confirm bool `json:"confirm,omitempty"`
 }
 
-// addScoreToUser, kullanıcıya belirtilen puanı ekler
-func (c *connection) addScoreToUser(userid string, score float64) {
-	c.RDB.ZIncrBy(c.CTX, constants.Leaderboard, score, userid)
+// validateReport checks that every participant exists and is not deleted;
+// it returns the HTTP status to use on failure
+func validateReport(rdb *redis.Client, ctx context.Context, m Match) (int, error) {
+	ids := make([]int, len(m.Players))
+	for i, p := range m.Players {
+		ids[i] = p.UserID
+	}
+
+	users, err := user.GetUsersByIDs(rdb, ctx, ids)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for _, id := range ids {
+		u, ok := users[id]
+		if !ok || u.DeletedAt != "" {
+			return http.StatusNotFound, fmt.Errorf("User %d not found", id)
+		}
+	}
+	return 0, nil
+}
+
+// authorizeReporter allows requests carrying the service credential, or from one of the participants.
+// It returns the caller's user ID, which is 0 for service requests.
+func authorizeReporter(rdb *redis.Client, ctx context.Context, r *http.Request, report MatchReport) (int, int, error) {
+	if authent.IsServiceRequest(r) {
+		return 0, 0, nil
+	}
+
+	callerID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+	if err != nil {
+		return 0, http.StatusUnauthorized, err
+	}
+	if !report.hasParticipant(callerID) {
+		return 0, http.StatusForbidden, errors.New("Only a participant can report this match")
+	}
+	return callerID, 0, nil
 }
 
 // MatchResultHandler, maç sonucunu işler ve puanları günceller
@@ -36,54 +95,119 @@ func MatchResultHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 			return
 		}
 
-		var con connection
-		con.RDB = rdb
-		con.CTX = ctx
+		var report MatchReport
+		err := json.NewDecoder(r.Body).Decode(&report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		var matchData struct {
-			UserID1 int `json:"userid1"`
-			UserID2 int `json:"userid2"`
-			Score1  int `json:"score1"`
-			Score2  int `json:"score2"`
+		callerID, status, err := authorizeReporter(rdb, ctx, r, report)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
 		}
 
-		err := json.NewDecoder(r.Body).Decode(&matchData)
+		// Aynı anahtarla gelen tekrar denemelerde ilk yanıtı aynen döndürüyoruz
+		idemKeys, err := idempotencyKeys(rdb, ctx, r, report)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		var claim *idempotencyClaim
+		finished := false
+		if len(idemKeys) > 0 {
+			hash, err := payloadHash(report)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
-		userID1 := strconv.Itoa(matchData.UserID1)
-		userID2 := strconv.Itoa(matchData.UserID2)
-		point1 := 1
-		point2 := 1
+			var stored *idempotencyRecord
+			claim, stored, err = beginIdempotent(rdb, ctx, idemKeys, hash)
+			if err == ErrIdempotencyConflict {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			} else if err == ErrIdempotencyInProgress {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
-		if matchData.Score1 > matchData.Score2 {
-			point1 = 3
-			point2 = 0
-		} else if matchData.Score1 < matchData.Score2 {
-			point1 = 0
-			point2 = 3
-		}
+			if stored != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Code)
+				w.Write(stored.Body)
+				return
+			}
 
-		con.addScoreToUser(userID1, float64(point1))
-		con.addScoreToUser(userID2, float64(point2))
+			// Yanıt saklanmadan dönülen her yolda (hata ya da panik) anahtarlar serbest bırakılır
+			defer func() {
+				if !finished {
+					claim.release(rdb, ctx)
+				}
+			}()
+		}
 
-		user1, err := user.GetUserByID(rdb, ctx, matchData.UserID1)
+		rules, err := scoring.ForLeague(rdb, ctx, report.League)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		user2, err := user.GetUserByID(rdb, ctx, matchData.UserID2)
+		m, err := buildMatch(report, rules)
+		if err == nil {
+			status, err = validateReport(rdb, ctx, m)
+		} else {
+			status = http.StatusBadRequest
+		}
+		if err == nil && (RequireConfirmation || report.Confirm) && callerID != 0 && m.Format != FormatDuel {
+			status, err = http.StatusBadRequest, errors.New("Only 1v1 matches can wait for confirmation; multi-player results must be reported by a service")
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), status)
 			return
 		}
 
-		fmt.Println(user1, user2)
+		var result interface{}
+		if (RequireConfirmation || report.Confirm) && callerID != 0 {
+			// Oyuncu bildirimi rakip onaylayana ya da süre dolana kadar bekletilir.
+			// players listesiyle gelen 1v1 bildirimi iki oyunculu alanlara çevrilir.
+			if len(report.Players) > 0 {
+				report.UserID1, report.Score1 = report.Players[0].UserID, report.Players[0].Score
+				report.UserID2, report.Score2 = report.Players[1].UserID, report.Players[1].Score
+				for _, p := range report.Players {
+					if p.Forfeit {
+						report.Forfeit = p.UserID
+					}
+				}
+				report.Players, report.Format = nil, ""
+			}
+			result, err = submitPending(rdb, ctx, report, callerID)
+		} else {
+			// Puanlar, maç kaydı ve dereceler tek MULTI içinde yazılır
+			err = RecordMatch(rdb, ctx, &m)
+			result = m
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		json.NewEncoder(w).Encode(Response{Status: true, Result: true})
+		var body bytes.Buffer
+		json.NewEncoder(&body).Encode(Response{Status: true, Result: result})
+		if claim != nil {
+			// Maç kaydedildi; yanıt saklanamasa da anahtarlar hemen serbest bırakılmaz
+			finished = true
+			err = claim.finish(rdb, ctx, http.StatusOK, body.Bytes())
+			if err != nil {
+				log.Printf("Idempotency keys %v could not be stored: %v", idemKeys, err)
+			}
+		}
+		w.Write(body.Bytes())
 	}
 }
 
@@ -106,38 +230,90 @@ func LeaderboardHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 		if err != nil || count < 1 {
 			count = 10
 		}
+		if count > MaxLeaderboardCount {
+			count = MaxLeaderboardCount
+		}
 
 		start := (page - 1) * count
-		end := start + count - 1
 
-		users, err := rdb.ZRevRangeWithScores(ctx, constants.Leaderboard, int64(start), int64(end)).Result()
+		key, status, err := boardKey(rdb, ctx, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		mode, err := rankingMode(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Sayfa, sıralama sürümüyle birlikte önbellek anahtarına girer; puan değişince yeniden hesaplanır
+		version, err := leaderboard.Version(rdb, ctx, key)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		cacheKey := fmt.Sprintf("%s:%d:%d:%d:%s", key, version, start, count, mode)
 
-		leaderboard := make([]map[string]interface{}, len(users))
-		for i, redisUser := range users {
-			userID, err := strconv.Atoi(redisUser.Member.(string))
+		cached, hit := leaderboard.Pages.Get(cacheKey)
+		if !hit {
+			ranked, err := leaderboard.Page(rdb, ctx, key, key, start, count, mode)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			u, err := user.GetUserByID(rdb, ctx, userID)
+			entries, err := rankedEntries(rdb, ctx, ranked)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			leaderboard[i] = map[string]interface{}{
-				"id":       u.ID,
-				"username": u.Username,
-				"rank":     start + i + 1,
-				"score":    redisUser.Score,
+			body, err := json.Marshal(Response{Status: true, Result: entries})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			cached = leaderboard.Pages.Put(cacheKey, append(body, '\n'))
+		}
+
+		w.Header().Set("ETag", cached.ETag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if hit {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), cached.ETag) {
+			leaderboard.Pages.NotModified()
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
+		w.Write(cached.Body)
+	}
+}
 
-		json.NewEncoder(w).Encode(Response{Status: true, Result: leaderboard})
+// etagMatches reports whether an If-None-Match header lists etag; weak validators also match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaderboardCacheStatsHandler reports the leaderboard page cache counters and hit rate.
+// Only callers with the service credential may read them.
+func LeaderboardCacheStatsHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Status: true, Result: leaderboard.Pages.Stats()})
 	}
 }
@@ -0,0 +1,275 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/season"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// MaxRankWindow, "etrafımdakiler" görünümünde üstte ve altta gösterilebilecek en fazla oyuncu sayısı
+const MaxRankWindow = 50
+
+// MaxLeaderboardCount, liderlik tablosunda bir sayfada döndürülebilecek en fazla oyuncu
+const MaxLeaderboardCount = 100
+
+// seasonParam reads the season query parameter, defaulting to the running season;
+// it returns the HTTP status to use on failure
+func seasonParam(rdb *redis.Client, ctx context.Context, query url.Values) (int, int, error) {
+	current, err := season.Current(rdb, ctx)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	seasonStr := query.Get("season")
+	if seasonStr == "" {
+		return current, 0, nil
+	}
+
+	seasonID, err := strconv.Atoi(seasonStr)
+	if err != nil || seasonID < 1 {
+		return 0, http.StatusBadRequest, errors.New("Invalid season")
+	}
+	if seasonID > current {
+		return 0, http.StatusNotFound, season.ErrSeasonNotFound
+	}
+	return seasonID, 0, nil
+}
+
+// boardKey resolves the leaderboard selected by the period and season query parameters;
+// it returns the HTTP status to use on failure
+func boardKey(rdb *redis.Client, ctx context.Context, query url.Values) (string, int, error) {
+	// period verilmezse süren sezonun (ya da season ile seçilen sezonun) tüm zamanlar sıralaması döner
+	seasonID, status, err := seasonParam(rdb, ctx, query)
+	if err != nil {
+		return "", status, err
+	}
+
+	key, err := leaderboard.Key(rdb, ctx, query.Get("period"), seasonID, time.Now())
+	if err == leaderboard.ErrUnknownPeriod {
+		return "", http.StatusBadRequest, err
+	} else if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return key, 0, nil
+}
+
+// rankingMode reads the ranking query parameter, falling back to the configured mode
+func rankingMode(query url.Values) (string, error) {
+	mode := query.Get("ranking")
+	if mode == "" {
+		return leaderboard.RankingMode, nil
+	}
+	if !leaderboard.ValidMode(mode) {
+		return "", leaderboard.ErrUnknownRankingMode
+	}
+	return mode, nil
+}
+
+// rankedEntries adds usernames to a ranked slice of the leaderboard. Players whose account
+// no longer exists keep their place with a null username until the purge removes them.
+func rankedEntries(rdb *redis.Client, ctx context.Context, ranked []leaderboard.Entry) ([]map[string]interface{}, error) {
+	userIDs := make([]int, len(ranked))
+	for i, e := range ranked {
+		userIDs[i] = e.UserID
+	}
+
+	// Sayfadaki kullanıcılar önbellekten, eksikler tek MGET ile alınır
+	profiles, err := user.GetPublicProfiles(rdb, ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]map[string]interface{}, len(ranked))
+	for i, e := range ranked {
+		entry := map[string]interface{}{
+			"id":              e.UserID,
+			"username":        nil,
+			"rank":            e.Rank,
+			"score":           e.Score,
+			"goal_difference": e.GoalDifference,
+		}
+		if u, ok := profiles[e.UserID]; ok {
+			entry["username"] = u.Username
+		} else {
+			entry["deleted"] = true
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// aroundUser returns a player's rank and score with up to window players above and below
+// them; redis.Nil is returned if the player is not on the board
+func aroundUser(rdb *redis.Client, ctx context.Context, key, mode string, userID, window int) (int, float64, []map[string]interface{}, error) {
+	position, err := leaderboard.Position(rdb, ctx, key, key, userID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	start := position - window
+	if start < 0 {
+		start = 0
+	}
+	ranked, err := leaderboard.Page(rdb, ctx, key, key, start, position-start+window+1, mode)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	var rank int
+	var score float64
+	for _, e := range ranked {
+		if e.UserID == userID {
+			rank, score = e.Rank, e.Score
+		}
+	}
+
+	entries, err := rankedEntries(rdb, ctx, ranked)
+	return rank, score, entries, err
+}
+
+// MyRankHandler returns the caller's rank and score together with up to window players
+// above and below them. period and season select the leaderboard as in LeaderboardHandler.
+func MyRankHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		window, err := strconv.Atoi(r.URL.Query().Get("window"))
+		if err != nil || window < 0 {
+			window = 5
+		}
+		if window > MaxRankWindow {
+			window = MaxRankWindow
+		}
+
+		key, status, err := boardKey(rdb, ctx, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		mode, err := rankingMode(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rank, score, entries, err := aroundUser(rdb, ctx, key, mode, userID, window)
+		if err == redis.Nil {
+			http.Error(w, "You are not on this leaderboard", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"rank":    rank,
+			"score":   score,
+			"entries": entries,
+		}})
+	}
+}
+
+// friendsBoardTTL, arkadaş sıralaması için oluşturulan geçici anahtarın en uzun ömrü
+const friendsBoardTTL = 30 * time.Second
+
+// FriendsLeaderboardHandler ranks the caller and their friends on the selected leaderboard.
+// The friends set is intersected with the leaderboard into a temporary key that is paged like the global one.
+func FriendsLeaderboardHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 1 {
+			count = 10
+		}
+		if count > MaxLeaderboardCount {
+			count = MaxLeaderboardCount
+		}
+		start := (page - 1) * count
+
+		key, status, err := boardKey(rdb, ctx, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		mode, err := rankingMode(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		member := strconv.Itoa(userID)
+		score, err := rdb.ZScore(ctx, key, member).Result()
+		ranked := err == nil
+		if err != nil && err != redis.Nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Arkadaşlık setinin skorları (arkadaşlık zamanı) 0 ağırlıkla yok sayılır
+		tmp := constants.FriendsBoardPrefix + member + ":" + uuid.New().String()
+		defer rdb.Del(ctx, tmp)
+
+		var total *redis.IntCmd
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZInterStore(ctx, tmp, &redis.ZStore{
+				Keys:    []string{key, constants.FriendPrefix + member},
+				Weights: []float64{1, 0},
+			})
+			if ranked {
+				pipe.ZAdd(ctx, tmp, &redis.Z{Score: score, Member: member})
+			}
+			pipe.Expire(ctx, tmp, friendsBoardTTL)
+			total = pipe.ZCard(ctx, tmp)
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Eşitlik bozucu veriler asıl sıralamanın anahtarlarından okunur
+		friends, err := leaderboard.Page(rdb, ctx, tmp, key, start, count, mode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		entries, err := rankedEntries(rdb, ctx, friends)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"total":   total.Val(),
+			"entries": entries,
+		}})
+	}
+}
@@ -0,0 +1,99 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"masomointern/internal/table"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MaxTableCount, lig tablosunda bir sayfada döndürülebilecek en fazla satır
+const MaxTableCount = 100
+
+// LeagueTableHandler pages through a season's league table sorted by any column.
+// sort defaults to points and order to desc; season defaults to the running season.
+func LeagueTableHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		column := query.Get("sort")
+		if column == "" {
+			column = "points"
+		}
+		if !table.ValidColumn(column) {
+			http.Error(w, "Invalid sort column", http.StatusBadRequest)
+			return
+		}
+		order := query.Get("order")
+		if order != "" && order != "asc" && order != "desc" {
+			http.Error(w, "Invalid order", http.StatusBadRequest)
+			return
+		}
+
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		count, err := strconv.Atoi(query.Get("count"))
+		if err != nil || count < 1 {
+			count = 10
+		}
+		if count > MaxTableCount {
+			count = MaxTableCount
+		}
+		start := int64((page - 1) * count)
+		end := start + int64(count) - 1
+
+		seasonID, status, err := seasonParam(rdb, ctx, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		key := table.ColumnKey(seasonID, column)
+		var members []string
+		if order == "asc" {
+			members, err = rdb.ZRange(ctx, key, start, end).Result()
+		} else {
+			members, err = rdb.ZRevRange(ctx, key, start, end).Result()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		userIDs := make([]int, len(members))
+		for i, member := range members {
+			userIDs[i], err = strconv.Atoi(member)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		rows, err := table.GetRows(rdb, ctx, seasonID, userIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profiles, err := user.GetPublicProfiles(rdb, ctx, userIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range rows {
+			rows[i].Username = profiles[rows[i].UserID].Username
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"season": seasonID,
+			"sort":   column,
+			"rows":   rows,
+		}})
+	}
+}
@@ -19,13 +19,66 @@ type Response struct {
 
 // İzin verilen metotları ve handler'ları bir haritada tanımlıyoruz
 var allowedMethods = map[string]string{
-	"RegisterHandler":    http.MethodPost,
-	"LoginHandler":       http.MethodPost,
-	"UpdateHandler":      http.MethodPost,
-	"MatchResultHandler": http.MethodPost,
-	"LeaderboardHandler": http.MethodGet,
-	"UserDetailsHandler": http.MethodGet,
-	"SimulationHandler":  http.MethodGet,
+	"RegisterHandler":              http.MethodPost,
+	"LoginHandler":                 http.MethodPost,
+	"UpdateHandler":                http.MethodPost,
+	"MatchResultHandler":           http.MethodPost,
+	"LeaderboardHandler":           http.MethodGet,
+	"UserDetailsHandler":           http.MethodGet,
+	"SimulationHandler":            http.MethodGet,
+	"AvatarUploadHandler":          http.MethodPost,
+	"DeleteAccountHandler":         http.MethodDelete,
+	"ExportRequestHandler":         http.MethodPost,
+	"ExportStatusHandler":          http.MethodGet,
+	"SearchUsersHandler":           http.MethodGet,
+	"BulkUserLookupHandler":        http.MethodPost,
+	"MatchHandler":                 http.MethodGet,
+	"MatchHistoryHandler":          http.MethodGet,
+	"RatingHandler":                http.MethodGet,
+	"RatingLeaderboardHandler":     http.MethodGet,
+	"RatingHistoryHandler":         http.MethodGet,
+	"PendingMatchesHandler":        http.MethodGet,
+	"ConfirmMatchHandler":          http.MethodPost,
+	"DisputesHandler":              http.MethodGet,
+	"ResolveDisputeHandler":        http.MethodPost,
+	"RuleSetsHandler":              http.MethodGet,
+	"LeagueRulesHandler":           http.MethodPost,
+	"SeasonsHandler":               http.MethodGet,
+	"RolloverHandler":              http.MethodPost,
+	"MyRankHandler":                http.MethodGet,
+	"FriendsLeaderboardHandler":    http.MethodGet,
+	"LeagueTableHandler":           http.MethodGet,
+	"HeadToHeadHandler":            http.MethodGet,
+	"LeaderboardCacheStatsHandler": http.MethodGet,
+	"LiveLeaderboardHandler":       http.MethodGet,
+	"NotificationStreamHandler":    http.MethodGet,
+	"StreamTicketHandler":          http.MethodPost,
+	"WebhooksHandler":              http.MethodGet,
+	"CreateWebhookHandler":         http.MethodPost,
+	"DeleteWebhookHandler":         http.MethodDelete,
+	"WebhookDeliveriesHandler":     http.MethodGet,
+	"ReplayWebhookHandler":         http.MethodPost,
+}
+
+// Akış handler'ları kimliği kendileri doğrular; tek kullanımlık bilet burada harcanmamalı
+var streamHandlers = map[string]bool{
+	"LiveLeaderboardHandler":    true,
+	"NotificationStreamHandler": true,
+}
+
+// Token yerine servis kimlik bilgisiyle de çağrılabilen handler'lar
+var serviceHandlers = map[string]bool{
+	"MatchResultHandler":           true,
+	"DisputesHandler":              true,
+	"ResolveDisputeHandler":        true,
+	"LeagueRulesHandler":           true,
+	"RolloverHandler":              true,
+	"LeaderboardCacheStatsHandler": true,
+	"WebhooksHandler":              true,
+	"CreateWebhookHandler":         true,
+	"DeleteWebhookHandler":         true,
+	"WebhookDeliveriesHandler":     true,
+	"ReplayWebhookHandler":         true,
 }
 
 func AuthMiddleware(rdb *redis.Client, ctx context.Context, handlerName string, next http.HandlerFunc) http.HandlerFunc {
@@ -48,7 +101,8 @@ func AuthMiddleware(rdb *redis.Client, ctx context.Context, handlerName string,
 		}
 
 		// Register ve Login dışındaki isteklerde token doğrulaması yapıyoruz
-		if handlerName != "RegisterHandler" && handlerName != "LoginHandler" {
+		isService := serviceHandlers[handlerName] && authent.IsServiceRequest(r)
+		if handlerName != "RegisterHandler" && handlerName != "LoginHandler" && !isService && !streamHandlers[handlerName] {
 			userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
 			if err != nil {
 				// JSON formatında hata yanıtı döndür
@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"context"
+	"strconv"
+
+	"masomointern/internal/events"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/season"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RegisterEventHandlers subscribes the notification streams to the domain events players are
+// told about. Events are delivered at least once, so a retried event may notify a player twice.
+func RegisterEventHandlers(rdb *redis.Client) {
+	events.Subscribe("notifications", func(ctx context.Context, e events.Event) error {
+		switch e.Type {
+		case events.FriendRequestSent:
+			var data events.FriendRequestData
+			if err := e.Decode(&data); err != nil {
+				return err
+			}
+			return Publish(rdb, ctx, data.ToUserID, FriendRequestReceived, map[string]string{
+				"user_id":  strconv.Itoa(data.FromUserID),
+				"username": data.FromUsername,
+			})
+
+		case events.FriendRequestAccepted:
+			// İsteği gönderen, kabul edildiğini öğrenir
+			var data events.FriendRequestData
+			if err := e.Decode(&data); err != nil {
+				return err
+			}
+			return Publish(rdb, ctx, data.FromUserID, FriendRequestAccepted, map[string]string{
+				"user_id":  strconv.Itoa(data.ToUserID),
+				"username": data.ToUsername,
+			})
+
+		case events.MatchReported:
+			var data events.MatchReportedData
+			if err := e.Decode(&data); err != nil {
+				return err
+			}
+			return notifyMatch(rdb, ctx, data)
+		}
+		return nil
+	}, events.FriendRequestSent, events.FriendRequestAccepted, events.MatchReported)
+}
+
+// notifyMatch tells every player of a recorded match about it, and about their new season rank
+// when it changed. Only the players of the match are told; others who were overtaken see it on
+// the leaderboard.
+func notifyMatch(rdb *redis.Client, ctx context.Context, data events.MatchReportedData) error {
+	ids := make([]int, len(data.Players))
+	for i, p := range data.Players {
+		ids[i] = p.UserID
+		err := Publish(rdb, ctx, p.UserID, MatchRecorded, map[string]interface{}{
+			"match_id":   data.MatchID,
+			"format":     data.Format,
+			"score":      p.Score,
+			"placement":  p.Placement,
+			"points":     p.Points,
+			"elo_change": p.EloChange,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if data.RanksBefore == nil {
+		return nil
+	}
+	ranksAfter, err := leaderboard.Ranks(rdb, ctx, season.Key(data.Season), ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		before, after := data.RanksBefore[id], ranksAfter[id]
+		if after == 0 || before == after {
+			continue
+		}
+		// İlk maçında sıralamaya giren oyuncunun önceki sırası 0 olarak gönderilir
+		err = Publish(rdb, ctx, id, RankChanged, map[string]interface{}{
+			"season":   data.Season,
+			"old_rank": before,
+			"new_rank": after,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
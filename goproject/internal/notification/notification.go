@@ -0,0 +1,250 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Bildirim türleri; SSE akışında olay adı olarak gönderilir
+const (
+	FriendRequestReceived = "friend_request_received"
+	FriendRequestAccepted = "friend_request_accepted"
+	MatchRecorded         = "match_recorded"
+	RankChanged           = "rank_changed"
+)
+
+var (
+	// StreamLength, her kullanıcının akışında yaklaşık olarak tutulan en fazla bildirim
+	StreamLength int64 = 500
+
+	// Retention, son bildirimden sonra akışın saklanma süresi
+	Retention = 7 * 24 * time.Hour
+
+	// KeepAliveInterval, yeni bildirim gelmeyen akışa canlı tutma yorumu gönderilme aralığı. Pub/Sub
+	// uyandırması kaçırılmışsa akış da bu aralıkla yeniden okunur.
+	KeepAliveInterval = 25 * time.Second
+)
+
+// streams, bu sunucudaki açık bildirim akışları; kullanıcı başına uyandırma kanalları
+var streams = struct {
+	sync.Mutex
+	subscribers map[int]map[chan struct{}]struct{}
+}{subscribers: make(map[int]map[chan struct{}]struct{})}
+
+func subscribe(userID int) chan struct{} {
+	wake := make(chan struct{}, 1)
+	streams.Lock()
+	defer streams.Unlock()
+	if streams.subscribers[userID] == nil {
+		streams.subscribers[userID] = make(map[chan struct{}]struct{})
+	}
+	streams.subscribers[userID][wake] = struct{}{}
+	return wake
+}
+
+func unsubscribe(userID int, wake chan struct{}) {
+	streams.Lock()
+	defer streams.Unlock()
+	delete(streams.subscribers[userID], wake)
+	if len(streams.subscribers[userID]) == 0 {
+		delete(streams.subscribers, userID)
+	}
+}
+
+// wakeUp signals every open stream of a user on this server without blocking
+func wakeUp(userID int) {
+	streams.Lock()
+	defer streams.Unlock()
+	for wake := range streams.subscribers[userID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// StartStreams listens for new notifications from all server instances and wakes the open
+// streams of their users. A single Pub/Sub connection serves every stream, so open streams do
+// not hold Redis connections while they wait.
+func StartStreams(rdb *redis.Client, ctx context.Context) {
+	go func() {
+		pubsub := rdb.Subscribe(ctx, constants.NotificationWakeups)
+		defer pubsub.Close()
+
+		for msg := range pubsub.Channel() {
+			userID, err := strconv.Atoi(msg.Payload)
+			if err != nil {
+				continue
+			}
+			wakeUp(userID)
+		}
+	}()
+}
+
+// streamBatch, akıştan bir seferde okunan en fazla bildirim
+const streamBatch = 100
+
+// streamIDPattern, Redis akış kimliği biçimi (ör. 1700000000000-0)
+var streamIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// Key returns the stream holding a user's notifications
+func Key(userID int) string {
+	return constants.NotificationPrefix + strconv.Itoa(userID)
+}
+
+// Publish appends an event to a user's notification stream
+func Publish(rdb *redis.Client, ctx context.Context, userID int, eventType string, data interface{}) error {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	key := Key(userID)
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: StreamLength,
+			Approx: true,
+			Values: map[string]interface{}{
+				"type":       eventType,
+				"data":       dataJSON,
+				"created_at": time.Now().Format(time.RFC3339),
+			},
+		})
+		pipe.Expire(ctx, key, Retention)
+		pipe.Publish(ctx, constants.NotificationWakeups, userID)
+		return nil
+	})
+	return err
+}
+
+// writeEvent writes a stream entry as a server-sent event
+func writeEvent(w http.ResponseWriter, msg redis.XMessage) {
+	eventType, _ := msg.Values["type"].(string)
+	data, _ := msg.Values["data"].(string)
+	createdAt, _ := msg.Values["created_at"].(string)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":       eventType,
+		"data":       json.RawMessage(data),
+		"created_at": createdAt,
+	})
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, eventType, payload)
+}
+
+// StreamHandler streams the caller's notifications as server-sent events. A client that
+// reconnects with Last-Event-ID (or the last_event_id query parameter) first receives the
+// events it missed; otherwise only new events are sent. EventSource cannot set headers, so the
+// stream also accepts a single-use ticket from /stream/ticket as the ticket query parameter.
+func StreamHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetStreamUserID(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		// Sunucunun WriteTimeout süresi akışı kesmesin diye bu yanıt için kaldırılır
+		controller := http.NewResponseController(w)
+
+		key := Key(userID)
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		if lastID != "" && !streamIDPattern.MatchString(lastID) {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		if lastID == "" {
+			// Yeni bağlantı yalnızca bundan sonraki bildirimleri alır
+			latest, err := rdb.XRevRangeN(ctx, key, "+", "-", 1).Result()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			lastID = "0-0"
+			if len(latest) > 0 {
+				lastID = latest[0].ID
+			}
+		}
+
+		if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", 3000)
+		flusher.Flush()
+
+		// Akış beklerken Redis bağlantısı tutmaz; yeni bildirimde StartStreams akışı uyandırır
+		wake := subscribe(userID)
+		defer unsubscribe(userID, wake)
+		keepAlive := time.NewTicker(KeepAliveInterval)
+		defer keepAlive.Stop()
+
+		streamCtx := r.Context()
+		for {
+			// Son gönderilen olaydan sonrakiler beklemeden okunur
+			for {
+				result, err := rdb.XRead(streamCtx, &redis.XReadArgs{
+					Streams: []string{key, lastID},
+					Count:   streamBatch,
+					Block:   -1,
+				}).Result()
+				if streamCtx.Err() != nil {
+					return
+				}
+				if err == redis.Nil {
+					break
+				} else if err != nil {
+					log.Printf("Notification stream for user %d failed: %v", userID, err)
+					return
+				}
+
+				read := 0
+				for _, stream := range result {
+					for _, msg := range stream.Messages {
+						writeEvent(w, msg)
+						lastID = msg.ID
+						read++
+					}
+				}
+				flusher.Flush()
+				if read < streamBatch {
+					break
+				}
+			}
+
+			select {
+			case <-wake:
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+			case <-streamCtx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package rating
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/user"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	SystemElo    = "elo"
+	SystemGlicko = "glicko"
+
+	InitialRating     = 1500.0
+	InitialDeviation  = 350.0
+	InitialVolatility = 0.06
+
+	glickoScale    = 173.7178 // Glicko-2 ölçeği ile Glicko ölçeği arasındaki dönüşüm katsayısı
+	glickoEpsilon  = 0.000001
+	maxHistorySize = 500
+
+	// MaxCount, derece listelerinde bir sayfada döndürülebilecek en fazla kayıt
+	MaxCount = 100
+)
+
+var (
+	KFactor = 32.0 // Elo K katsayısı
+	Tau     = 0.5  // Glicko-2 volatilite değişim kısıtı
+)
+
+type Response struct {
+	Status  bool        `json:"status"`
+	Result  interface{} `json:"result"`
+	Message string      `json:"message"`
+}
+
+// Rating, kullanıcının her iki sistemdeki güncel derecesi
+type Rating struct {
+	UserID     int     `json:"user_id"`
+	Elo        float64 `json:"elo"`
+	Glicko     float64 `json:"glicko"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+	Matches    int     `json:"matches"`
+	UpdatedAt  string  `json:"updated_at,omitempty"`
+}
+
+// HistoryEntry, bir maç sonrası derece değişiminin kaydı
+type HistoryEntry struct {
+	MatchID    int     `json:"match_id"`
+	Elo        float64 `json:"elo"`
+	EloChange  float64 `json:"elo_change"`
+	Glicko     float64 `json:"glicko"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+	At         string  `json:"at"`
+}
+
+// Participant, derece hesabı için bir oyuncunun maçtaki yeri
+type Participant struct {
+	UserID    int
+	Team      string // Aynı takımdaki oyuncular birbirine karşı oynamış sayılmaz
+	Placement int    // 1 en iyi; eşit sıradakiler berabere sayılır
+}
+
+// Opponent, Glicko-2 hesabında bir rakibin maç öncesi değerleri ve sonuç
+type Opponent struct {
+	Rating    float64
+	Deviation float64
+	Result    float64 // 1 galibiyet, 0.5 beraberlik, 0 mağlubiyet
+}
+
+func newRating(userID int) Rating {
+	return Rating{
+		UserID:     userID,
+		Elo:        InitialRating,
+		Glicko:     InitialRating,
+		Deviation:  InitialDeviation,
+		Volatility: InitialVolatility,
+	}
+}
+
+func leaderboardKey(system string) string {
+	return constants.RatingLeaderboardPrefix + system
+}
+
+// outcome converts two placements into the first player's result: 1 win, 0.5 draw, 0 loss
+func outcome(placement1, placement2 int) float64 {
+	if placement1 < placement2 {
+		return 1
+	} else if placement1 > placement2 {
+		return 0
+	}
+	return 0.5
+}
+
+// expectedScore returns the first player's expected Elo result against the second
+func expectedScore(r1, r2 float64) float64 {
+	return 1 / (1 + math.Pow(10, (r2-r1)/400))
+}
+
+// Glicko2Period updates a player's rating, deviation and volatility after a rating period
+// with games against each of the given opponents
+func Glicko2Period(r, rd, vol float64, opponents []Opponent, tau float64) (float64, float64, float64) {
+	mu := (r - InitialRating) / glickoScale
+	phi := rd / glickoScale
+	if len(opponents) == 0 {
+		return r, rd, vol
+	}
+
+	var vInv, sum float64
+	for _, o := range opponents {
+		muJ := (o.Rating - InitialRating) / glickoScale
+		phiJ := o.Deviation / glickoScale
+
+		g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		vInv += g * g * e * (1 - e)
+		sum += g * (o.Result - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	// Yeni volatilite Illinois yöntemiyle bulunur
+	a := math.Log(vol * vol)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA := f(A)
+	fB := f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A = B
+			fA = fB
+		} else {
+			fA = fA / 2
+		}
+		B = C
+		fB = fC
+	}
+	newVol := math.Exp(A / 2)
+
+	phiStar := math.Sqrt(phi*phi + newVol*newVol)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*sum
+
+	return glickoScale*newMu + InitialRating, glickoScale * newPhi, newVol
+}
+
+func getRating(c redis.Cmdable, ctx context.Context, userID int) (Rating, error) {
+	ratingJSON, err := c.Get(ctx, constants.RatingPrefix+strconv.Itoa(userID)).Result()
+	if err == redis.Nil {
+		return newRating(userID), nil
+	} else if err != nil {
+		return Rating{}, err
+	}
+
+	var rt Rating
+	err = json.Unmarshal([]byte(ratingJSON), &rt)
+	return rt, err
+}
+
+// GetRating returns the user's current rating, or the initial rating if they have not played yet
+func GetRating(rdb *redis.Client, ctx context.Context, userID int) (Rating, error) {
+	return getRating(rdb, ctx, userID)
+}
+
+// Update holds the new ratings computed for one match, ready to be written
+type Update struct {
+	Changes map[int]float64 // Kullanıcı ID'sine göre Elo değişimi
+	matchID int
+	ratings []Rating
+	at      string
+}
+
+// WatchKeys returns the keys a caller must WATCH while preparing and writing an Update
+func WatchKeys(userIDs ...int) []string {
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = constants.RatingPrefix + strconv.Itoa(id)
+	}
+	return keys
+}
+
+// PrepareMatch reads the participants' ratings and computes their Elo and Glicko-2 values after the match.
+// Every participant is compared with each participant of another team; the Elo K-factor is split
+// across those pairings so a two-player match gives the classic Elo update.
+func PrepareMatch(c redis.Cmdable, ctx context.Context, matchID int, participants []Participant) (Update, error) {
+	before := make([]Rating, len(participants))
+	for i, p := range participants {
+		rt, err := getRating(c, ctx, p.UserID)
+		if err != nil {
+			return Update{}, err
+		}
+		before[i] = rt
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	update := Update{Changes: make(map[int]float64, len(participants)), matchID: matchID, at: now}
+
+	for i, p := range participants {
+		var eloDelta float64
+		var opponents []Opponent
+		for j, q := range participants {
+			if i == j || (p.Team != "" && p.Team == q.Team) {
+				continue
+			}
+			s := outcome(p.Placement, q.Placement)
+			eloDelta += s - expectedScore(before[i].Elo, before[j].Elo)
+			opponents = append(opponents, Opponent{Rating: before[j].Glicko, Deviation: before[j].Deviation, Result: s})
+		}
+		if len(opponents) > 0 {
+			eloDelta *= KFactor / float64(len(opponents))
+		}
+
+		// Tüm oyuncular maç öncesi değerlerle güncellenir
+		rt := before[i]
+		rt.Elo += eloDelta
+		rt.Glicko, rt.Deviation, rt.Volatility = Glicko2Period(rt.Glicko, rt.Deviation, rt.Volatility, opponents, Tau)
+		rt.Matches++
+		rt.UpdatedAt = now
+
+		update.Changes[p.UserID] = eloDelta
+		update.ratings = append(update.ratings, rt)
+	}
+	return update, nil
+}
+
+// Queue adds the rating, rating leaderboard and history writes of the update to a pipeline
+func (u Update) Queue(pipe redis.Pipeliner, ctx context.Context) error {
+	for _, rt := range u.ratings {
+		ratingJSON, err := json.Marshal(rt)
+		if err != nil {
+			return err
+		}
+		entryJSON, err := json.Marshal(HistoryEntry{
+			MatchID:    u.matchID,
+			Elo:        rt.Elo,
+			EloChange:  u.Changes[rt.UserID],
+			Glicko:     rt.Glicko,
+			Deviation:  rt.Deviation,
+			Volatility: rt.Volatility,
+			At:         u.at,
+		})
+		if err != nil {
+			return err
+		}
+
+		id := strconv.Itoa(rt.UserID)
+		historyKey := constants.RatingHistoryPrefix + id
+		pipe.Set(ctx, constants.RatingPrefix+id, ratingJSON, 0)
+		pipe.ZAdd(ctx, leaderboardKey(SystemElo), &redis.Z{Score: rt.Elo, Member: id})
+		pipe.ZAdd(ctx, leaderboardKey(SystemGlicko), &redis.Z{Score: rt.Glicko, Member: id})
+		pipe.LPush(ctx, historyKey, entryJSON)
+		pipe.LTrim(ctx, historyKey, 0, maxHistorySize-1)
+	}
+	return nil
+}
+
+func pagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 {
+		count = 10
+	}
+	if count > MaxCount {
+		count = MaxCount
+	}
+	return page, count
+}
+
+// userIDParam returns the userid query parameter, or the caller's ID if it is missing
+func userIDParam(rdb *redis.Client, ctx context.Context, r *http.Request) (int, error) {
+	if idStr := r.URL.Query().Get("userid"); idStr != "" {
+		return strconv.Atoi(idStr)
+	}
+	return authent.GetUserIDFromToken(rdb, ctx, r)
+}
+
+// RatingHandler returns a user's current ratings
+func RatingHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDParam(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		rt, err := GetRating(rdb, ctx, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: rt})
+	}
+}
+
+// RatingLeaderboardHandler ranks users by rating; system selects elo (default) or glicko
+func RatingLeaderboardHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		system := r.URL.Query().Get("system")
+		if system == "" {
+			system = SystemElo
+		}
+		if system != SystemElo && system != SystemGlicko {
+			http.Error(w, "Invalid rating system", http.StatusBadRequest)
+			return
+		}
+
+		page, count := pagination(r)
+		start := (page - 1) * count
+		end := start + count - 1
+
+		entries, err := rdb.ZRevRangeWithScores(ctx, leaderboardKey(system), int64(start), int64(end)).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		userIDs := make([]int, len(entries))
+		for i, entry := range entries {
+			userIDs[i], err = strconv.Atoi(entry.Member.(string))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		profiles, err := user.GetPublicProfiles(rdb, ctx, userIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		leaderboard := make([]map[string]interface{}, len(entries))
+		for i, entry := range entries {
+			leaderboard[i] = map[string]interface{}{
+				"id":       userIDs[i],
+				"username": nil,
+				"rank":     start + i + 1,
+				"rating":   entry.Score,
+			}
+			// Hesabı silinmiş oyuncular temizlenene kadar kullanıcı adı olmadan listelenir
+			if u, ok := profiles[userIDs[i]]; ok {
+				leaderboard[i]["username"] = u.Username
+			} else {
+				leaderboard[i]["deleted"] = true
+			}
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: leaderboard})
+	}
+}
+
+// RatingHistoryHandler pages through a user's rating changes, newest first
+func RatingHistoryHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDParam(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		page, count := pagination(r)
+		start := (page - 1) * count
+		end := start + count - 1
+
+		entriesJSON, err := rdb.LRange(ctx, constants.RatingHistoryPrefix+strconv.Itoa(userID), int64(start), int64(end)).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		history := make([]HistoryEntry, 0, len(entriesJSON))
+		for _, entryJSON := range entriesJSON {
+			var entry HistoryEntry
+			err = json.Unmarshal([]byte(entryJSON), &entry)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			history = append(history, entry)
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: history})
+	}
+}
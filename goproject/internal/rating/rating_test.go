@@ -0,0 +1,85 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		placement1, placement2 int
+		want                   float64
+	}{
+		{1, 2, 1},
+		{2, 1, 0},
+		{3, 3, 0.5},
+	}
+	for _, tt := range tests {
+		if got := outcome(tt.placement1, tt.placement2); got != tt.want {
+			t.Errorf("outcome(%d, %d) = %v, want %v", tt.placement1, tt.placement2, got, tt.want)
+		}
+	}
+}
+
+func TestExpectedScore(t *testing.T) {
+	tests := []struct {
+		r1, r2 float64
+		want   float64
+	}{
+		{1500, 1500, 0.5},
+		{1900, 1500, 10.0 / 11},
+		{1500, 1900, 1.0 / 11},
+		{1700, 1500, 1 / (1 + math.Pow(10, -0.5))},
+	}
+	for _, tt := range tests {
+		if got := expectedScore(tt.r1, tt.r2); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("expectedScore(%v, %v) = %v, want %v", tt.r1, tt.r2, got, tt.want)
+		}
+	}
+}
+
+func TestGlicko2Period(t *testing.T) {
+	tests := []struct {
+		name                 string
+		r, rd, vol           float64
+		opponents            []Opponent
+		wantR, wantRD, wantV float64
+	}{
+		{
+			// Glickman, "Example of the Glicko-2 system", τ = 0.5
+			name: "glickman example",
+			r:    1500, rd: 200, vol: 0.06,
+			opponents: []Opponent{
+				{Rating: 1400, Deviation: 30, Result: 1},
+				{Rating: 1550, Deviation: 100, Result: 0},
+				{Rating: 1700, Deviation: 300, Result: 0},
+			},
+			wantR: 1464.06, wantRD: 151.52, wantV: 0.05999,
+		},
+		{
+			// Maç oynamayan oyuncunun değerleri değişmez
+			name: "no games",
+			r:    1620, rd: 80, vol: 0.06,
+			wantR: 1620, wantRD: 80, wantV: 0.06,
+		},
+	}
+	for _, tt := range tests {
+		r, rd, vol := Glicko2Period(tt.r, tt.rd, tt.vol, tt.opponents, 0.5)
+		if math.Abs(r-tt.wantR) > 0.01 || math.Abs(rd-tt.wantRD) > 0.01 || math.Abs(vol-tt.wantV) > 0.00001 {
+			t.Errorf("%s: Glicko2Period = (%.4f, %.4f, %.6f), want (%.2f, %.2f, %.5f)",
+				tt.name, r, rd, vol, tt.wantR, tt.wantRD, tt.wantV)
+		}
+	}
+}
+
+func TestGlicko2PeriodDraw(t *testing.T) {
+	// Eşit oyuncular arasındaki beraberlik dereceyi değiştirmez, yalnızca sapmayı daraltır
+	r, rd, _ := Glicko2Period(InitialRating, InitialDeviation, InitialVolatility,
+		[]Opponent{{Rating: InitialRating, Deviation: InitialDeviation, Result: 0.5}}, Tau)
+	if math.Abs(r-InitialRating) > 1e-9 {
+		t.Errorf("rating after draw = %v, want %v", r, InitialRating)
+	}
+	if rd >= InitialDeviation {
+		t.Errorf("deviation after draw = %v, want less than %v", rd, InitialDeviation)
+	}
+}
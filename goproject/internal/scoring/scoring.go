@@ -0,0 +1,300 @@
+package scoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Response struct {
+	Status  bool        `json:"status"`
+	Result  interface{} `json:"result"`
+	Message string      `json:"message"`
+}
+
+// RuleSet, bir maç sonucunun puana nasıl çevrileceğini tanımlar
+type RuleSet struct {
+	Name string `json:"name"`
+
+	// İki taraflı maçlarda (1v1 ya da iki takım) temel puanlar
+	Win  int `json:"win"`
+	Draw int `json:"draw"`
+	Loss int `json:"loss"`
+
+	// MarginBonus, kazananın her fark golü için aldığı ek puan; MarginCap sayılan farkı sınırlar (0 ise sınırsız)
+	MarginBonus int `json:"margin_bonus,omitempty"`
+	MarginCap   int `json:"margin_cap,omitempty"`
+
+	// Hükmen sonuçlanan maçlarda puanlar; ForfeitScore sıfırdan büyükse kayda geçen skor ForfeitScore-0 olur
+	ForfeitWin   int `json:"forfeit_win"`
+	ForfeitLoss  int `json:"forfeit_loss"`
+	ForfeitScore int `json:"forfeit_score,omitempty"`
+
+	// İkiden fazla taraflı maçlarda sıralamaya göre puanlar; listede olmayan sıralar 0 puan alır
+	PlacementPoints []int `json:"placement_points"`
+}
+
+// Side, bir tarafın (oyuncu ya da takım) maçtaki skoru
+type Side struct {
+	Score   int
+	Forfeit bool
+}
+
+// Result, bir tarafın kurallara göre hesaplanan sonucu
+type Result struct {
+	Score          int // Hükmen maçlarda düzeltilmiş olabilir
+	Placement      int // 1 en iyi; eşit sıradakiler berabere sayılır
+	Points         int
+	GoalDifference int // MarginCap ile sınırlanmış skor farkı
+}
+
+var (
+	Standard = RuleSet{Name: "standard", Win: 3, Draw: 1, Loss: 0, ForfeitWin: 3, ForfeitLoss: 0, ForfeitScore: 3, PlacementPoints: []int{10, 6, 4, 3, 2, 1}}
+	Classic  = RuleSet{Name: "classic", Win: 2, Draw: 1, Loss: 0, ForfeitWin: 2, ForfeitLoss: 0, ForfeitScore: 3, PlacementPoints: []int{10, 6, 4, 3, 2, 1}}
+	Bonus    = RuleSet{Name: "bonus", Win: 3, Draw: 1, Loss: 0, MarginBonus: 1, MarginCap: 3, ForfeitWin: 3, ForfeitLoss: -1, ForfeitScore: 3, PlacementPoints: []int{10, 6, 4, 3, 2, 1}}
+)
+
+var ErrUnknownRuleSet = errors.New("Unknown scoring rule set")
+
+var ruleSets = map[string]RuleSet{
+	Standard.Name: Standard,
+	Classic.Name:  Classic,
+	Bonus.Name:    Bonus,
+}
+
+// Default, ligi için kural atanmamış maçlarda kullanılan kural setinin adı
+var Default = Standard.Name
+
+// Register adds or replaces a named rule set
+func Register(rs RuleSet) error {
+	if rs.Name == "" {
+		return errors.New("Rule set name is required")
+	}
+	if rs.MarginCap < 0 || rs.MarginBonus < 0 || rs.ForfeitScore < 0 {
+		return fmt.Errorf("Rule set %s has negative margin or forfeit settings", rs.Name)
+	}
+	ruleSets[rs.Name] = rs
+	return nil
+}
+
+// LoadFile registers the rule sets listed in a JSON file
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var list []RuleSet
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	for _, rs := range list {
+		err = Register(rs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a rule set by name
+func Get(name string) (RuleSet, error) {
+	rs, ok := ruleSets[name]
+	if !ok {
+		return RuleSet{}, ErrUnknownRuleSet
+	}
+	return rs, nil
+}
+
+// ForLeague returns the rule set assigned to the league, or the default one
+func ForLeague(rdb *redis.Client, ctx context.Context, league string) (RuleSet, error) {
+	name := Default
+	if league != "" {
+		assigned, err := rdb.HGet(ctx, constants.LeagueRules, league).Result()
+		if err != nil && err != redis.Nil {
+			return RuleSet{}, err
+		}
+		if assigned != "" {
+			name = assigned
+		}
+	}
+	return Get(name)
+}
+
+// Placements ranks scores highest first with standard competition ranking (1, 2, 2, 4)
+func Placements(scores []int) []int {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	result := make([]int, len(scores))
+	for rank, idx := range order {
+		if rank > 0 && scores[idx] == scores[order[rank-1]] {
+			result[idx] = result[order[rank-1]]
+		} else {
+			result[idx] = rank + 1
+		}
+	}
+	return result
+}
+
+// margin, iki skor arasındaki farkı MarginCap ile sınırlar
+func (rs RuleSet) margin(score, other int) int {
+	diff := score - other
+	if rs.MarginCap > 0 {
+		if diff > rs.MarginCap {
+			diff = rs.MarginCap
+		} else if diff < -rs.MarginCap {
+			diff = -rs.MarginCap
+		}
+	}
+	return diff
+}
+
+// Score applies the rule set to the sides of a match. Forfeiting sides rank below everyone else.
+func (rs RuleSet) Score(sides []Side) []Result {
+	results := make([]Result, len(sides))
+	forfeits := 0
+	for i, s := range sides {
+		results[i].Score = s.Score
+		if s.Forfeit {
+			forfeits++
+		}
+	}
+
+	// Hükmen kaybeden tek taraf varsa rakibin skoru kurala göre düzeltilir
+	if len(sides) == 2 && forfeits == 1 && rs.ForfeitScore > 0 {
+		for i, s := range sides {
+			if s.Forfeit {
+				results[i].Score = 0
+			} else {
+				results[i].Score = rs.ForfeitScore
+			}
+		}
+	}
+
+	// Hükmen kaybedenler sıralamada en alta düşer
+	ranked := make([]int, len(sides))
+	for i, s := range sides {
+		ranked[i] = results[i].Score
+		if s.Forfeit {
+			ranked[i] = -1
+		}
+	}
+	placements := Placements(ranked)
+	shared := make(map[int]int, len(placements))
+	for _, p := range placements {
+		shared[p]++
+	}
+
+	for i, s := range sides {
+		results[i].Placement = placements[i]
+
+		if len(sides) == 2 {
+			other := results[1-i].Score
+			results[i].GoalDifference = rs.margin(results[i].Score, other)
+
+			switch {
+			case s.Forfeit:
+				results[i].Points = rs.ForfeitLoss
+			case sides[1-i].Forfeit:
+				results[i].Points = rs.ForfeitWin
+			case shared[placements[i]] > 1:
+				results[i].Points = rs.Draw
+			case placements[i] == 1:
+				results[i].Points = rs.Win + rs.MarginBonus*results[i].GoalDifference
+			default:
+				results[i].Points = rs.Loss
+			}
+			continue
+		}
+
+		if s.Forfeit {
+			results[i].Points = rs.ForfeitLoss
+		} else if placements[i]-1 < len(rs.PlacementPoints) {
+			results[i].Points = rs.PlacementPoints[placements[i]-1]
+		}
+	}
+	return results
+}
+
+// RuleSetsHandler lists the registered rule sets, the default and league assignments
+func RuleSetsHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		leagues, err := rdb.HGetAll(ctx, constants.LeagueRules).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		names := make([]string, 0, len(ruleSets))
+		for name := range ruleSets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]RuleSet, len(names))
+		for i, name := range names {
+			list[i] = ruleSets[name]
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"default":   Default,
+			"rule_sets": list,
+			"leagues":   leagues,
+		}})
+	}
+}
+
+// LeagueRulesHandler assigns a rule set to a league; an empty rule set name removes the assignment.
+// Only callers with the service credential may change league rules.
+func LeagueRulesHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		var request struct {
+			League string `json:"league"`
+			Rules  string `json:"rules"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.League == "" {
+			http.Error(w, "League is required", http.StatusBadRequest)
+			return
+		}
+
+		if request.Rules == "" {
+			err = rdb.HDel(ctx, constants.LeagueRules, request.League).Err()
+		} else if _, err = Get(request.Rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else {
+			err = rdb.HSet(ctx, constants.LeagueRules, request.League, request.Rules).Err()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Message: "League rules updated"})
+	}
+}
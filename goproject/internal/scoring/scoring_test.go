@@ -0,0 +1,115 @@
+package scoring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlacements(t *testing.T) {
+	tests := []struct {
+		scores []int
+		want   []int
+	}{
+		{[]int{}, []int{}},
+		{[]int{5}, []int{1}},
+		{[]int{3, 1, 2}, []int{1, 3, 2}},
+		{[]int{2, 2, 1}, []int{1, 1, 3}},
+		{[]int{1, 4, 4, 4}, []int{4, 1, 1, 1}},
+		{[]int{3, 5, 5, 1}, []int{3, 1, 1, 4}},
+	}
+	for _, tt := range tests {
+		if got := Placements(tt.scores); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Placements(%v) = %v, want %v", tt.scores, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules RuleSet
+		sides []Side
+		want  []Result
+	}{
+		{
+			name:  "standard win",
+			rules: Standard,
+			sides: []Side{{Score: 2}, {Score: 1}},
+			want:  []Result{{Score: 2, Placement: 1, Points: 3, GoalDifference: 1}, {Score: 1, Placement: 2, Points: 0, GoalDifference: -1}},
+		},
+		{
+			name:  "standard draw",
+			rules: Standard,
+			sides: []Side{{Score: 1}, {Score: 1}},
+			want:  []Result{{Score: 1, Placement: 1, Points: 1}, {Score: 1, Placement: 1, Points: 1}},
+		},
+		{
+			// Hükmen maçta skor ForfeitScore-0 olarak yeniden yazılır
+			name:  "standard forfeit",
+			rules: Standard,
+			sides: []Side{{Score: 1}, {Score: 2, Forfeit: true}},
+			want:  []Result{{Score: 3, Placement: 1, Points: 3, GoalDifference: 3}, {Score: 0, Placement: 2, Points: 0, GoalDifference: -3}},
+		},
+		{
+			name:  "standard placements",
+			rules: Standard,
+			sides: []Side{{Score: 3}, {Score: 5}, {Score: 5}, {Score: 1}},
+			want:  []Result{{Score: 3, Placement: 3, Points: 4}, {Score: 5, Placement: 1, Points: 10}, {Score: 5, Placement: 1, Points: 10}, {Score: 1, Placement: 4, Points: 3}},
+		},
+		{
+			// Çok taraflı maçta hükmen kaybeden, skoru ne olursa olsun en alta düşer
+			name:  "standard placements with forfeit",
+			rules: Standard,
+			sides: []Side{{Score: 4, Forfeit: true}, {Score: 2}, {Score: 0}},
+			want:  []Result{{Score: 4, Placement: 3, Points: 0}, {Score: 2, Placement: 1, Points: 10}, {Score: 0, Placement: 2, Points: 6}},
+		},
+		{
+			name:  "classic win",
+			rules: Classic,
+			sides: []Side{{Score: 3}, {Score: 0}},
+			want:  []Result{{Score: 3, Placement: 1, Points: 2, GoalDifference: 3}, {Score: 0, Placement: 2, Points: 0, GoalDifference: -3}},
+		},
+		{
+			name:  "classic forfeit",
+			rules: Classic,
+			sides: []Side{{Forfeit: true}, {}},
+			want:  []Result{{Score: 0, Placement: 2, Points: 0, GoalDifference: -3}, {Score: 3, Placement: 1, Points: 2, GoalDifference: 3}},
+		},
+		{
+			name:  "bonus win",
+			rules: Bonus,
+			sides: []Side{{Score: 2}, {Score: 1}},
+			want:  []Result{{Score: 2, Placement: 1, Points: 4, GoalDifference: 1}, {Score: 1, Placement: 2, Points: 0, GoalDifference: -1}},
+		},
+		{
+			// Fark bonusu MarginCap ile sınırlanır
+			name:  "bonus capped margin",
+			rules: Bonus,
+			sides: []Side{{Score: 0}, {Score: 5}},
+			want:  []Result{{Score: 0, Placement: 2, Points: 0, GoalDifference: -3}, {Score: 5, Placement: 1, Points: 6, GoalDifference: 3}},
+		},
+		{
+			name:  "bonus draw",
+			rules: Bonus,
+			sides: []Side{{Score: 2}, {Score: 2}},
+			want:  []Result{{Score: 2, Placement: 1, Points: 1}, {Score: 2, Placement: 1, Points: 1}},
+		},
+		{
+			name:  "bonus forfeit",
+			rules: Bonus,
+			sides: []Side{{Score: 1}, {Score: 1, Forfeit: true}},
+			want:  []Result{{Score: 3, Placement: 1, Points: 3, GoalDifference: 3}, {Score: 0, Placement: 2, Points: -1, GoalDifference: -3}},
+		},
+		{
+			name:  "bonus placements with forfeit",
+			rules: Bonus,
+			sides: []Side{{Score: 1}, {Score: 3}, {Score: 2, Forfeit: true}},
+			want:  []Result{{Score: 1, Placement: 2, Points: 6}, {Score: 3, Placement: 1, Points: 10}, {Score: 2, Placement: 3, Points: -1}},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Score(tt.sides); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Score(%v) = %+v, want %+v", tt.name, tt.sides, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package season
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Response struct {
+	Status  bool        `json:"status"`
+	Result  interface{} `json:"result"`
+	Message string      `json:"message"`
+}
+
+var (
+	Length = time.Duration(0) // 0 ise sezonlar yalnızca elle kapatılır
+	Carry  = 0.0              // Zamanlanmış geçişte yeni sezona taşınan puan oranı
+)
+
+// rolloverRetries, WATCH çakışmasında sezon geçişinin kaç kez deneneceği
+const rolloverRetries = 5
+
+var (
+	ErrSeasonNotFound = errors.New("Season not found")
+	ErrSeasonChanged  = errors.New("Season was already rolled over")
+)
+
+// Season, bir sezonun bilgileri; EndedAt boşsa sezon sürüyor
+type Season struct {
+	ID        int     `json:"id"`
+	StartedAt string  `json:"started_at"`
+	EndedAt   string  `json:"ended_at,omitempty"`
+	Carry     float64 `json:"carry"`             // Önceki sezondan taşınan puan oranı
+	Players   int     `json:"players,omitempty"` // Sezon kapandığında sıralamadaki oyuncu sayısı
+}
+
+// Key returns the leaderboard key of a season
+func Key(id int) string {
+	return constants.SeasonLeaderboardPrefix + strconv.Itoa(id)
+}
+
+// Current returns the ID of the running season
+func Current(c redis.Cmdable, ctx context.Context) (int, error) {
+	id, err := c.Get(ctx, constants.CurrentSeason).Int()
+	if err == redis.Nil {
+		return 1, nil
+	}
+	return id, err
+}
+
+// CurrentKey returns the leaderboard key of the running season
+func CurrentKey(c redis.Cmdable, ctx context.Context) (string, error) {
+	id, err := Current(c, ctx)
+	if err != nil {
+		return "", err
+	}
+	return Key(id), nil
+}
+
+// Get loads a season's metadata
+func Get(c redis.Cmdable, ctx context.Context, id int) (Season, error) {
+	seasonJSON, err := c.Get(ctx, constants.SeasonPrefix+strconv.Itoa(id)).Result()
+	if err == redis.Nil {
+		return Season{}, ErrSeasonNotFound
+	} else if err != nil {
+		return Season{}, err
+	}
+
+	var s Season
+	err = json.Unmarshal([]byte(seasonJSON), &s)
+	return s, err
+}
+
+func queueSeason(pipe redis.Pipeliner, ctx context.Context, s Season) error {
+	seasonJSON, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, constants.SeasonPrefix+strconv.Itoa(s.ID), seasonJSON, 0)
+	return nil
+}
+
+// initScript, ilk sezonu başlatır ve sezonlardan önceki sıralamayı ona taşır. Adımlar tek
+// seferde çalıştığından yarıda kalan bir başlatma sonraki açılışta tamamlanır.
+var initScript = redis.NewScript(`
+redis.call("SETNX", KEYS[1], 1)
+if redis.call("GET", KEYS[1]) ~= "1" then
+	return 0
+end
+redis.call("SETNX", KEYS[2], ARGV[1])
+if redis.call("EXISTS", KEYS[3]) == 1 and redis.call("EXISTS", KEYS[4]) == 0 then
+	redis.call("RENAME", KEYS[3], KEYS[4])
+end
+return 1
+`)
+
+// Init starts the first season on a fresh database and moves the pre-season
+// leaderboard into it. The legacy leaderboard is checked on every start while the
+// first season is running, so a migration interrupted by a crash is finished later.
+func Init(rdb *redis.Client, ctx context.Context) error {
+	seasonJSON, err := json.Marshal(Season{ID: 1, StartedAt: time.Now().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+
+	keys := []string{constants.CurrentSeason, constants.SeasonPrefix + "1", constants.Leaderboard, Key(1)}
+	return initScript.Run(ctx, rdb, keys, seasonJSON).Err()
+}
+
+// List returns every season, oldest first
+func List(rdb *redis.Client, ctx context.Context) ([]Season, error) {
+	current, err := Current(rdb, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, current)
+	for i := range keys {
+		keys[i] = constants.SeasonPrefix + strconv.Itoa(i+1)
+	}
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	seasons := make([]Season, 0, len(values))
+	for i, value := range values {
+		seasonJSON, ok := value.(string)
+		if !ok {
+			// Bilgisi olmayan sezonlar da listelenir
+			seasons = append(seasons, Season{ID: i + 1})
+			continue
+		}
+
+		var s Season
+		err = json.Unmarshal([]byte(seasonJSON), &s)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, s)
+	}
+	return seasons, nil
+}
+
+// Rollover closes the running season and starts the next one. The closed season's leaderboard
+// is kept as its final standings; carry (0-1) of every player's points moves to the new season.
+// If expectedID is not 0 and another season is running, ErrSeasonChanged is returned.
+func Rollover(rdb *redis.Client, ctx context.Context, expectedID int, carry float64) (Season, error) {
+	if carry < 0 || carry > 1 {
+		return Season{}, errors.New("Carry must be between 0 and 1")
+	}
+
+	var next Season
+	for i := 0; i < rolloverRetries; i++ {
+		id, err := Current(rdb, ctx)
+		if err != nil {
+			return Season{}, err
+		}
+		if expectedID != 0 && id != expectedID {
+			return Season{}, ErrSeasonChanged
+		}
+
+		rollover := func(tx *redis.Tx) error {
+			current, err := Current(tx, ctx)
+			if err != nil {
+				return err
+			}
+			if current != id {
+				return redis.TxFailedErr
+			}
+
+			finished, err := Get(tx, ctx, id)
+			if err == ErrSeasonNotFound {
+				finished = Season{ID: id}
+			} else if err != nil {
+				return err
+			}
+
+			standings, err := tx.ZRangeWithScores(ctx, Key(id), 0, -1).Result()
+			if err != nil {
+				return err
+			}
+
+			now := time.Now().Format(time.RFC3339)
+			finished.EndedAt = now
+			finished.Players = len(standings)
+			next = Season{ID: id + 1, StartedAt: now, Carry: carry}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				err := queueSeason(pipe, ctx, finished)
+				if err != nil {
+					return err
+				}
+				err = queueSeason(pipe, ctx, next)
+				if err != nil {
+					return err
+				}
+
+				// Yumuşak sıfırlama: puanların bir kısmı tam sayıya yuvarlanarak yeni sezona taşınır
+				if carry > 0 {
+					counts := map[float64]int64{}
+					for _, z := range standings {
+						points := math.Floor(z.Score * carry)
+						if points > 0 {
+							pipe.ZAdd(ctx, Key(next.ID), &redis.Z{Score: points, Member: z.Member})
+							counts[points]++
+						}
+					}
+					// Farklı skor kümesi de yazılır; tam sayı puanlar Redis'in skor biçimiyle aynı yazılır
+					for points, n := range counts {
+						label := strconv.FormatFloat(points, 'f', -1, 64)
+						pipe.ZAdd(ctx, Key(next.ID)+constants.BoardScoresSuffix, &redis.Z{Score: points, Member: label})
+						pipe.HSet(ctx, Key(next.ID)+constants.BoardScoreCountsSuffix, label, n)
+					}
+				}
+				pipe.Set(ctx, constants.CurrentSeason, next.ID, 0)
+				// Yeni sezonun sıralamasına önceden önbelleğe alınmış sayfa kalmasın
+				pipe.Incr(ctx, Key(next.ID)+constants.BoardVersionSuffix)
+				return nil
+			})
+			return err
+		}
+
+		err = rdb.Watch(ctx, rollover, constants.CurrentSeason, Key(id))
+		if err != redis.TxFailedErr {
+			return next, err
+		}
+	}
+	return Season{}, errors.New("Season rollover failed: too many concurrent changes")
+}
+
+// StartSeasonWorker rolls the season over once it has run for Length
+func StartSeasonWorker(rdb *redis.Client, ctx context.Context, interval time.Duration) {
+	if Length <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			id, err := Current(rdb, ctx)
+			if err != nil {
+				log.Printf("Season worker: %v", err)
+				continue
+			}
+			s, err := Get(rdb, ctx, id)
+			if err != nil {
+				log.Printf("Season worker: season %d: %v", id, err)
+				continue
+			}
+			started, err := time.Parse(time.RFC3339, s.StartedAt)
+			if err != nil || time.Since(started) < Length {
+				continue
+			}
+
+			// Birden fazla sunucu aynı sezonu kapatmaya çalışırsa yalnızca biri başarılı olur
+			_, err = Rollover(rdb, ctx, id, Carry)
+			if err != nil && err != ErrSeasonChanged {
+				log.Printf("Season worker: rollover of season %d: %v", id, err)
+			}
+		}
+	}()
+}
+
+// SeasonsHandler lists all seasons and the running season's ID
+func SeasonsHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seasons, err := List(rdb, ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"current": len(seasons),
+			"seasons": seasons,
+		}})
+	}
+}
+
+// RolloverHandler closes the running season. The optional body {"season": id, "carry": 0.25}
+// guards against closing a season twice and sets the carried share of points.
+func RolloverHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		request := struct {
+			Season int      `json:"season"`
+			Carry  *float64 `json:"carry"`
+		}{}
+		if r.ContentLength != 0 {
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		carry := Carry
+		if request.Carry != nil {
+			carry = *request.Carry
+		}
+		if carry < 0 || carry > 1 {
+			http.Error(w, "Carry must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		next, err := Rollover(rdb, ctx, request.Season, carry)
+		if err == ErrSeasonChanged {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: next, Message: "Season rolled over"})
+	}
+}
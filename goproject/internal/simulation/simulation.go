@@ -3,10 +3,17 @@ package simulation
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"masomointern/internal/constants"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/match"
+	"masomointern/internal/scoring"
+	"masomointern/internal/season"
+	"masomointern/internal/table"
 	"masomointern/internal/user"
 
 	"github.com/go-redis/redis/v8"
@@ -24,8 +31,37 @@ type Connection struct {
 	CTX context.Context // Context nesnesi
 }
 
-func (c *Connection) AddScoreToUser(userID string, score float64) error {
-	return c.RDB.ZIncrBy(c.CTX, constants.Leaderboard, score, userID).Err()
+// addRetries, WATCH çakışmasında sonucun kaç kez yazılmaya çalışılacağı
+const addRetries = 5
+
+// AddResult, maç sonucunu süren sezonun ve günlük/haftalık/aylık dönemlerin sıralamasına
+// ve sezonun puan tablosuna tek bir MULTI içinde ekler
+func (c *Connection) AddResult(result leaderboard.Result, outcome table.Outcome) error {
+	seasonID, err := season.Current(c.RDB, c.CTX)
+	if err != nil {
+		return err
+	}
+
+	apply := func(tx *redis.Tx) error {
+		row, err := table.Get(tx, c.CTX, seasonID, result.UserID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(c.CTX, func(pipe redis.Pipeliner) error {
+			leaderboard.QueueResult(pipe, c.CTX, season.Key(seasonID), result, time.Now())
+			table.Queue(pipe, c.CTX, seasonID, row.Apply(outcome))
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < addRetries; i++ {
+		err = c.RDB.Watch(c.CTX, apply, table.Key(seasonID, result.UserID))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.New("Result could not be recorded: too many concurrent changes")
 }
 
 type SimMatchData struct {
@@ -42,6 +78,12 @@ func SimulateMatches(rdb *redis.Client, ctx context.Context, users []user.User)
 		con.RDB = rdb
 		con.CTX = ctx
 
+		rules, err := scoring.ForLeague(rdb, ctx, r.URL.Query().Get("league"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		var matches []SimMatchData
 
 		for i := 0; i < userCount; i++ {
@@ -49,22 +91,32 @@ func SimulateMatches(rdb *redis.Client, ctx context.Context, users []user.User)
 				score1 := rand.Intn(5)
 				score2 := rand.Intn(5)
 
-				match := SimMatchData{
+				simulated := SimMatchData{
 					UserID1: users[i].ID,
 					UserID2: users[j].ID,
 					Score1:  score1,
 					Score2:  score2,
 				}
 
-				matches = append(matches, match)
+				matches = append(matches, simulated)
 
-				if score1 > score2 {
-					con.AddScoreToUser(strconv.Itoa(users[i].ID), 3)
-				} else if score1 < score2 {
-					con.AddScoreToUser(strconv.Itoa(users[j].ID), 3)
-				} else {
-					con.AddScoreToUser(strconv.Itoa(users[i].ID), 1)
-					con.AddScoreToUser(strconv.Itoa(users[j].ID), 1)
+				// Skorlar, puanlar ve G/B/M sonuçları canlı maçlarla aynı kodla hesaplanır
+				_, results, outcomes, err := match.Preview(match.MatchReport{
+					UserID1: users[i].ID,
+					UserID2: users[j].ID,
+					Score1:  score1,
+					Score2:  score2,
+				}, rules)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for k := range results {
+					err = con.AddResult(results[k], outcomes[k])
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
 				}
 			}
 		}
@@ -134,6 +186,11 @@ func addUserToUserlist(rdb *redis.Client, ctx context.Context, userCount int) ([
 			return nil, err
 		}
 
+		err = user.IndexUsername(rdb, ctx, newUser.Username, newUser.ID)
+		if err != nil {
+			return nil, err
+		}
+
 		users = append(users, newUser)
 	}
 
@@ -0,0 +1,204 @@
+package table
+
+import (
+	"context"
+	"strconv"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	Win  = "W"
+	Draw = "D"
+	Loss = "L"
+
+	// FormLength, form dizisinde tutulan son maç sayısı
+	FormLength = 5
+)
+
+// Columns, puan tablosunun sıralanabilen sütunları; her biri ayrı bir sorted set'te tutulur
+var Columns = []string{"points", "played", "wins", "draws", "losses", "goals_for", "goals_against", "goal_difference", "streak"}
+
+// Outcome, bir oyuncunun tek maçtaki sonucu
+type Outcome struct {
+	Result       string // W, D ya da L
+	GoalsFor     int
+	GoalsAgainst int
+	Points       int
+}
+
+// Row, bir oyuncunun sezon boyunca biriken istatistikleri
+type Row struct {
+	UserID         int    `json:"userid"`
+	Username       string `json:"username,omitempty"`
+	Points         int    `json:"points"`
+	Played         int    `json:"played"`
+	Wins           int    `json:"wins"`
+	Draws          int    `json:"draws"`
+	Losses         int    `json:"losses"`
+	GoalsFor       int    `json:"goals_for"`
+	GoalsAgainst   int    `json:"goals_against"`
+	GoalDifference int    `json:"goal_difference"`
+	Streak         string `json:"streak"` // Örn. W3: son üç maç galibiyet
+	Form           string `json:"form"`   // Son maçlar, en yenisi başta
+}
+
+// Key returns the hash holding a player's stats for a season
+func Key(seasonID, userID int) string {
+	return constants.StatsPrefix + strconv.Itoa(seasonID) + ":" + strconv.Itoa(userID)
+}
+
+// ColumnKey returns the sorted set that orders a season's table by a column
+func ColumnKey(seasonID int, column string) string {
+	return constants.TablePrefix + strconv.Itoa(seasonID) + ":" + column
+}
+
+// ValidColumn reports whether the table can be sorted by column
+func ValidColumn(column string) bool {
+	for _, c := range Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchKeys returns the stats keys to WATCH before updating the given players
+func WatchKeys(seasonID int, userIDs ...int) []string {
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = Key(seasonID, id)
+	}
+	return keys
+}
+
+func parseRow(userID int, fields map[string]string) Row {
+	atoi := func(name string) int {
+		v, _ := strconv.Atoi(fields[name])
+		return v
+	}
+	return Row{
+		UserID:         userID,
+		Points:         atoi("points"),
+		Played:         atoi("played"),
+		Wins:           atoi("wins"),
+		Draws:          atoi("draws"),
+		Losses:         atoi("losses"),
+		GoalsFor:       atoi("goals_for"),
+		GoalsAgainst:   atoi("goals_against"),
+		GoalDifference: atoi("goal_difference"),
+		Streak:         fields["streak"],
+		Form:           fields["form"],
+	}
+}
+
+// Get loads a player's row; a player without matches gets an empty row
+func Get(c redis.Cmdable, ctx context.Context, seasonID, userID int) (Row, error) {
+	fields, err := c.HGetAll(ctx, Key(seasonID, userID)).Result()
+	if err != nil {
+		return Row{}, err
+	}
+	return parseRow(userID, fields), nil
+}
+
+// GetRows loads the rows of several players with one pipeline, keeping the given order
+func GetRows(rdb *redis.Client, ctx context.Context, seasonID int, userIDs []int) ([]Row, error) {
+	cmds := make([]*redis.StringStringMapCmd, len(userIDs))
+	_, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range userIDs {
+			cmds[i] = pipe.HGetAll(ctx, Key(seasonID, id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]Row, len(userIDs))
+	for i, id := range userIDs {
+		rows[i] = parseRow(id, cmds[i].Val())
+	}
+	return rows, nil
+}
+
+// streakValue, seri sütununun sıralama değeri: galibiyet serisi pozitif, mağlubiyet serisi negatif
+func streakValue(streak string) int {
+	if len(streak) < 2 {
+		return 0
+	}
+	n, _ := strconv.Atoi(streak[1:])
+	switch streak[:1] {
+	case Win:
+		return n
+	case Loss:
+		return -n
+	}
+	return 0
+}
+
+// Apply returns the row after one more match
+func (row Row) Apply(o Outcome) Row {
+	row.Played++
+	row.Points += o.Points
+	row.GoalsFor += o.GoalsFor
+	row.GoalsAgainst += o.GoalsAgainst
+	row.GoalDifference = row.GoalsFor - row.GoalsAgainst
+
+	switch o.Result {
+	case Win:
+		row.Wins++
+	case Draw:
+		row.Draws++
+	case Loss:
+		row.Losses++
+	}
+
+	if len(row.Streak) > 1 && row.Streak[:1] == o.Result {
+		n, _ := strconv.Atoi(row.Streak[1:])
+		row.Streak = o.Result + strconv.Itoa(n+1)
+	} else {
+		row.Streak = o.Result + "1"
+	}
+
+	row.Form = o.Result + row.Form
+	if len(row.Form) > FormLength {
+		row.Form = row.Form[:FormLength]
+	}
+	return row
+}
+
+// Queue writes a row and its position in every column's sorted set
+func Queue(pipe redis.Pipeliner, ctx context.Context, seasonID int, row Row) {
+	member := strconv.Itoa(row.UserID)
+	values := map[string]int{
+		"points":          row.Points,
+		"played":          row.Played,
+		"wins":            row.Wins,
+		"draws":           row.Draws,
+		"losses":          row.Losses,
+		"goals_for":       row.GoalsFor,
+		"goals_against":   row.GoalsAgainst,
+		"goal_difference": row.GoalDifference,
+		"streak":          streakValue(row.Streak),
+	}
+
+	fields := make(map[string]interface{}, len(values)+2)
+	for column, value := range values {
+		fields[column] = value
+		pipe.ZAdd(ctx, ColumnKey(seasonID, column), &redis.Z{Score: float64(value), Member: member})
+	}
+	fields["streak"] = row.Streak
+	fields["form"] = row.Form
+	pipe.HSet(ctx, Key(seasonID, row.UserID), fields)
+}
+
+// QueueRemove deletes a player's row from a season's table
+func QueueRemove(pipe redis.Pipeliner, ctx context.Context, seasonID, userID int) {
+	member := strconv.Itoa(userID)
+	for _, column := range Columns {
+		pipe.ZRem(ctx, ColumnKey(seasonID, column), member)
+	}
+	pipe.Del(ctx, Key(seasonID, userID))
+}
@@ -0,0 +1,243 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/events"
+	"masomointern/internal/storage"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	MaxAvatarSize      = 2 << 20 // 2 MB
+	MaxAvatarDimension = 4096
+	MinAvatarDimension = 32
+)
+
+// ThumbnailSizes, yüklenen avatardan üretilecek kare küçük resimlerin kenar uzunlukları
+var ThumbnailSizes = []int{256, 64}
+
+// AvatarUploadHandler accepts a PNG or JPEG avatar as multipart field "avatar",
+// stores it with its thumbnails in the blob store and updates the user profile
+func AvatarUploadHandler(rdb *redis.Client, ctx context.Context, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Multipart başlıkları için biraz pay bırakıyoruz
+		r.Body = http.MaxBytesReader(w, r.Body, MaxAvatarSize+64<<10)
+		file, _, err := r.FormFile("avatar")
+		if err != nil {
+			http.Error(w, "Avatar file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, MaxAvatarSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > MaxAvatarSize {
+			http.Error(w, "Avatar is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		img, format, err := decodeAvatar(data)
+		if err != nil {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: err.Error()})
+			return
+		}
+
+		u, err := GetUserByID(rdb, ctx, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		prefix := avatarPrefix(userID)
+		originalKey := prefix + "original." + format
+		err = store.Put(originalKey, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		thumbnails := make(map[string]string, len(ThumbnailSizes))
+		for _, size := range ThumbnailSizes {
+			thumb, err := encodeImage(resizeSquare(img, size), format)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			key := fmt.Sprintf("%s%d.%s", prefix, size, format)
+			err = store.Put(key, thumb)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			thumbnails[strconv.Itoa(size)] = store.URL(key)
+		}
+
+		u.AvatarURL = store.URL(originalKey)
+		u.AvatarThumbnails = thumbnails
+		err = SaveUser(rdb, ctx, u)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Biçim değiştiyse önceki avatarın dosyaları artık kullanılmıyor
+		for _, other := range avatarFormats {
+			if other != format {
+				deleteBlobs(store, avatarKeys(userID, other))
+			}
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: PublicProfile(u)})
+	}
+}
+
+// avatarFormats, kabul edilen avatar biçimleri; dosya uzantısı olarak da kullanılır
+var avatarFormats = []string{"png", "jpeg"}
+
+func avatarPrefix(userID int) string {
+	return "avatars/" + strconv.Itoa(userID) + "/"
+}
+
+// avatarKeys returns the blob keys of a user's avatar original and thumbnails in one format
+func avatarKeys(userID int, format string) []string {
+	prefix := avatarPrefix(userID)
+	keys := []string{prefix + "original." + format}
+	for _, size := range ThumbnailSizes {
+		keys = append(keys, fmt.Sprintf("%s%d.%s", prefix, size, format))
+	}
+	return keys
+}
+
+// deleteBlobs removes blobs, logging failures; a leftover file is not worth failing the request for
+func deleteBlobs(store storage.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			log.Printf("Blob %s could not be deleted: %v", key, err)
+		}
+	}
+}
+
+// decodeAvatar checks format and dimensions before decoding the whole image
+func decodeAvatar(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("Avatar must be a PNG or JPEG image")
+	}
+	if format != "png" && format != "jpeg" {
+		return nil, "", errors.New("Avatar must be a PNG or JPEG image")
+	}
+	if cfg.Width > MaxAvatarDimension || cfg.Height > MaxAvatarDimension {
+		return nil, "", fmt.Errorf("Avatar must be at most %dx%d pixels", MaxAvatarDimension, MaxAvatarDimension)
+	}
+	if cfg.Width < MinAvatarDimension || cfg.Height < MinAvatarDimension {
+		return nil, "", fmt.Errorf("Avatar must be at least %dx%d pixels", MinAvatarDimension, MinAvatarDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errors.New("Avatar could not be decoded")
+	}
+	return img, format, nil
+}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// resizeSquare crops the centre square of img and scales it to size x size
+// by averaging the source pixels that fall into each target pixel
+func resizeSquare(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0 := y0 + y*side/size
+		sy1 := y0 + (y+1)*side/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0 := x0 + x*side/size
+			sx1 := x0 + (x+1)*side/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// RegisterEventHandlers subscribes the user package to the events it reacts to
+func RegisterEventHandlers(store storage.BlobStore) {
+	// Silinen kullanıcının avatar dosyaları
+	events.Subscribe("avatars", func(ctx context.Context, e events.Event) error {
+		var data events.UserPurgedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		for _, format := range avatarFormats {
+			for _, key := range avatarKeys(data.UserID, format) {
+				if err := store.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, events.UserPurged)
+}
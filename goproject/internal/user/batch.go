@@ -0,0 +1,83 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MaxBatchSize, tek istekte sorgulanabilecek en fazla ID + kullanıcı adı sayısı
+const MaxBatchSize = 100
+
+// BatchLookup, toplu kullanıcı sorgusunun istek gövdesi
+type BatchLookup struct {
+	IDs       []int    `json:"ids"`
+	Usernames []string `json:"usernames"`
+}
+
+// BulkUserLookupHandler returns public profiles for up to MaxBatchSize IDs or usernames.
+// Every requested ID appears in "users"; unknown or deleted ones map to null.
+// Every requested username appears in "usernames" mapped to its ID, or null if unknown.
+func BulkUserLookupHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var lookup BatchLookup
+		err := json.NewDecoder(r.Body).Decode(&lookup)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(lookup.IDs)+len(lookup.Usernames) == 0 {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: "IDs or usernames are required"})
+			return
+		}
+		if len(lookup.IDs)+len(lookup.Usernames) > MaxBatchSize {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: fmt.Sprintf("At most %d users can be requested at once", MaxBatchSize)})
+			return
+		}
+
+		usernameIDs, err := GetUserIDsByUsernames(rdb, ctx, lookup.Usernames)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids := append([]int{}, lookup.IDs...)
+		for _, id := range usernameIDs {
+			ids = append(ids, id)
+		}
+
+		users, err := GetUsersByIDs(rdb, ctx, ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		profiles := make(map[string]*User, len(ids))
+		for _, id := range ids {
+			u, ok := users[id]
+			if !ok || u.DeletedAt != "" {
+				profiles[strconv.Itoa(id)] = nil
+				continue
+			}
+			profile := PublicProfile(u)
+			profiles[strconv.Itoa(id)] = &profile
+		}
+
+		resolved := make(map[string]*int, len(lookup.Usernames))
+		for _, username := range lookup.Usernames {
+			id, ok := usernameIDs[username]
+			if !ok {
+				resolved[username] = nil
+				continue
+			}
+			resolved[username] = &id
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"users": profiles, "usernames": resolved}})
+	}
+}
@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/events"
+	"masomointern/internal/leaderboard"
+	"masomointern/internal/season"
+	"masomointern/internal/table"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DeletionGracePeriod, silinen hesabın geri alınabileceği süre
+var DeletionGracePeriod = 7 * 24 * time.Hour
+
+// purgeRetries, WATCH çakışmasında silme işleminin kaç kez deneneceği
+const purgeRetries = 5
+
+// ErrDeletionCancelled is returned by PurgeUser when the account was restored before it was purged
+var ErrDeletionCancelled = errors.New("Account is no longer scheduled for deletion")
+
+// DeleteAccountHandler marks the caller's account for deletion after confirming the password.
+// The account is purged by the background worker once the grace period is over;
+// logging in again before that restores it.
+func DeleteAccountHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var confirmation struct {
+			Password string `json:"password"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&confirmation)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		u, err := GetUserByID(rdb, ctx, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if !checkHashedPassword(confirmation.Password, u.Password) {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: "Invalid password!"})
+			return
+		}
+
+		now := time.Now()
+		purgeAt := now.Add(DeletionGracePeriod)
+		u.DeletedAt = now.Format(time.RFC3339)
+		err = SaveUser(rdb, ctx, u)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = rdb.ZAdd(ctx, constants.DeletionQueue, &redis.Z{Score: float64(purgeAt.Unix()), Member: strconv.Itoa(userID)}).Err()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Hesap silinmeye işaretlendiğinde tüm oturumlar kapatılır
+		err = authent.RevokeUserTokens(rdb, ctx, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"purge_at": purgeAt.Format(time.RFC3339)}})
+	}
+}
+
+// cancelDeletion restores a soft-deleted account
+func cancelDeletion(rdb *redis.Client, ctx context.Context, u *User) error {
+	u.DeletedAt = ""
+	err := SaveUser(rdb, ctx, *u)
+	if err != nil {
+		return err
+	}
+	return rdb.ZRem(ctx, constants.DeletionQueue, strconv.Itoa(u.ID)).Err()
+}
+
+// PurgeUser removes the user and every reference to it from Redis in one transaction. An account
+// that was restored in the meantime is left alone and ErrDeletionCancelled is returned. The
+// user's files are removed by the subscribers of the UserPurged event published with the purge.
+func PurgeUser(rdb *redis.Client, ctx context.Context, userID int) error {
+	id := strconv.Itoa(userID)
+	userKey := constants.UserPrefix + id
+	friendsKey := constants.FriendPrefix + id
+	requestsKey := constants.FriendRequestPrefix + id
+	sentKey := constants.SentRequestPrefix + id
+	tokensKey := constants.UserTokensPrefix + id
+
+	purge := func(tx *redis.Tx) error {
+		// Kullanıcı kaydı zaten silinmişse kalan indeksleri yine de temizliyoruz
+		var u User
+		userJSON, err := tx.Get(ctx, userKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(userJSON), &u)
+			if err != nil {
+				return err
+			}
+
+			// Bekleme süresinde tekrar giriş yapan kullanıcının hesabı geri alınmıştır
+			if u.DeletedAt == "" {
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					pipe.ZRem(ctx, constants.DeletionQueue, id)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				return ErrDeletionCancelled
+			}
+		}
+
+		friends, err := tx.ZRange(ctx, friendsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		requesters, err := tx.ZRange(ctx, requestsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		targets, err := tx.ZRange(ctx, sentKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		tokens, err := tx.SMembers(ctx, tokensKey).Result()
+		if err != nil {
+			return err
+		}
+		opponentIDs, err := tx.SMembers(ctx, constants.OpponentsPrefix+id).Result()
+		if err != nil {
+			return err
+		}
+		seasons, err := season.Current(tx, ctx)
+		if err != nil {
+			return err
+		}
+
+		// Geçmiş sezonlar ve süresi dolmamış dönem sıralamaları, rakiplerin ikili averaj kayıtlarıyla birlikte
+		boards := leaderboard.ActiveKeys(time.Now())
+		for s := 1; s <= seasons; s++ {
+			boards = append(boards, season.Key(s))
+		}
+		opponents := make([][]string, len(boards))
+		for i, board := range boards {
+			opponents[i], err = leaderboard.Opponents(tx, ctx, board, userID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, friendID := range friends {
+				pipe.ZRem(ctx, constants.FriendPrefix+friendID, id)
+			}
+			for _, requesterID := range requesters {
+				pipe.ZRem(ctx, constants.SentRequestPrefix+requesterID, id)
+			}
+			for _, targetID := range targets {
+				pipe.ZRem(ctx, constants.FriendRequestPrefix+targetID, id)
+			}
+			for _, token := range tokens {
+				pipe.Del(ctx, constants.TokenPrefix+token)
+			}
+			// İkili karşılaşma indeksleri; maç kayıtları rakiplerin geçmişi için kalır
+			for _, opponentID := range opponentIDs {
+				a, b := id, opponentID
+				if other, _ := strconv.Atoi(opponentID); other < userID {
+					a, b = opponentID, id
+				}
+				pipe.Del(ctx, constants.HeadToHeadPrefix+a+":"+b)
+				pipe.SRem(ctx, constants.OpponentsPrefix+opponentID, id)
+			}
+			pipe.Del(ctx, constants.OpponentsPrefix+id)
+			for i, board := range boards {
+				leaderboard.QueueRemove(pipe, ctx, board, userID, opponents[i])
+			}
+			for s := 1; s <= seasons; s++ {
+				table.QueueRemove(pipe, ctx, s, userID)
+			}
+			pipe.ZRem(ctx, constants.RatingLeaderboardPrefix+"elo", id)
+			pipe.ZRem(ctx, constants.RatingLeaderboardPrefix+"glicko", id)
+			pipe.Del(ctx, userKey, friendsKey, requestsKey, sentKey, tokensKey, constants.UserMatchesPrefix+id, constants.RatingPrefix+id, constants.RatingHistoryPrefix+id)
+			if u.Username != "" {
+				pipe.Del(ctx, constants.UsernamePrefix+u.Username)
+				queueUnindexUsername(pipe, ctx, u.Username, userID)
+			}
+			pipe.Del(ctx, constants.NotificationPrefix+id)
+			pipe.ZRem(ctx, constants.DeletionQueue, id)
+			// Avatar ve dışa aktarma arşivleri olay aboneleri tarafından blob deposundan silinir
+			return events.QueuePublish(pipe, ctx, events.UserPurged, events.UserPurgedData{UserID: userID})
+		})
+		return err
+	}
+
+	for i := 0; i < purgeRetries; i++ {
+		err := rdb.Watch(ctx, purge, userKey, friendsKey, requestsKey, sentKey, tokensKey, constants.OpponentsPrefix+id, constants.CurrentSeason)
+		if err == nil {
+			InvalidateProfile(userID)
+		}
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errors.New("Purge failed: too many concurrent changes")
+}
+
+// StartPurgeWorker periodically purges accounts whose grace period has expired
+func StartPurgeWorker(rdb *redis.Client, ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			due, err := rdb.ZRangeByScore(ctx, constants.DeletionQueue, &redis.ZRangeBy{
+				Min: "-inf",
+				Max: strconv.FormatInt(time.Now().Unix(), 10),
+			}).Result()
+			if err != nil {
+				log.Printf("Purge worker: %v", err)
+				continue
+			}
+
+			for _, idStr := range due {
+				userID, err := strconv.Atoi(idStr)
+				if err != nil {
+					rdb.ZRem(ctx, constants.DeletionQueue, idStr)
+					continue
+				}
+
+				err = PurgeUser(rdb, ctx, userID)
+				if err != nil && err != ErrDeletionCancelled {
+					log.Printf("Purge worker: user %d: %v", userID, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,126 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ProfileCacheTTL, herkese açık profillerin süreç içinde önbellekte tutulma süresi; 0 önbelleği kapatır.
+	// Başka bir sunucuda yapılan profil değişiklikleri en geç bu süre sonunda görünür.
+	ProfileCacheTTL = 30 * time.Second
+
+	// ProfileCacheSize, önbellekte tutulabilecek en fazla profil sayısı
+	ProfileCacheSize = 50000
+)
+
+// cachedProfile, önbellekteki bir profil; found false ise kullanıcı yok ya da silinmiş
+type cachedProfile struct {
+	profile User
+	found   bool
+	expires time.Time
+}
+
+var profileCache = struct {
+	sync.Mutex
+	entries map[int]cachedProfile
+}{entries: make(map[int]cachedProfile)}
+
+// InvalidateProfile drops a user's cached public profile after it changes
+func InvalidateProfile(id int) {
+	profileCache.Lock()
+	delete(profileCache.entries, id)
+	profileCache.Unlock()
+}
+
+// storeProfiles caches the results of a lookup, making room by dropping expired entries first
+func storeProfiles(profiles map[int]cachedProfile) {
+	profileCache.Lock()
+	defer profileCache.Unlock()
+
+	if len(profileCache.entries)+len(profiles) > ProfileCacheSize {
+		now := time.Now()
+		for id, p := range profileCache.entries {
+			if now.After(p.expires) {
+				delete(profileCache.entries, id)
+			}
+		}
+		// Hâlâ yer yoksa önbellek baştan kurulur
+		if len(profileCache.entries)+len(profiles) > ProfileCacheSize {
+			profileCache.entries = make(map[int]cachedProfile)
+		}
+	}
+	for id, p := range profiles {
+		profileCache.entries[id] = p
+	}
+}
+
+// rankedProfile returns the public profile with the user's ID; PublicProfile leaves the ID
+// out, but leaderboards need it
+func rankedProfile(u User) User {
+	profile := PublicProfile(u)
+	profile.ID = u.ID
+	return profile
+}
+
+// GetPublicProfiles returns the public profiles of the given users, served from a short-lived
+// cache where possible and fetched with a single MGET otherwise. Unknown and deleted users are
+// left out of the map.
+func GetPublicProfiles(rdb *redis.Client, ctx context.Context, ids []int) (map[int]User, error) {
+	profiles := make(map[int]User, len(ids))
+	if ProfileCacheTTL <= 0 {
+		users, err := GetUsersByIDs(rdb, ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id, u := range users {
+			if u.DeletedAt == "" {
+				profiles[id] = rankedProfile(u)
+			}
+		}
+		return profiles, nil
+	}
+
+	now := time.Now()
+	missing := []int{}
+	profileCache.Lock()
+	for _, id := range ids {
+		p, ok := profileCache.entries[id]
+		if !ok || now.After(p.expires) {
+			missing = append(missing, id)
+			continue
+		}
+		if p.found {
+			profiles[id] = p.profile
+		}
+	}
+	profileCache.Unlock()
+
+	if len(missing) == 0 {
+		return profiles, nil
+	}
+
+	users, err := GetUsersByIDs(rdb, ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bulunamayan kullanıcılar da önbelleğe alınır; böylece silinmiş oyuncular her istekte sorgulanmaz
+	fetched := make(map[int]cachedProfile, len(missing))
+	expires := now.Add(ProfileCacheTTL)
+	for _, id := range missing {
+		u, ok := users[id]
+		if !ok || u.DeletedAt != "" {
+			fetched[id] = cachedProfile{expires: expires}
+			continue
+		}
+		profile := rankedProfile(u)
+		profiles[id] = profile
+		fetched[id] = cachedProfile{profile: profile, found: true, expires: expires}
+	}
+	storeProfiles(fetched)
+	return profiles, nil
+}
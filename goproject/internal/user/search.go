@@ -0,0 +1,247 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Kullanıcı adı indeksi tek bir sorted set; tüm skorlar 0 olduğu için üyeler
+// leksikografik sıralanır ve ZRANGEBYLEX ile önek araması yapılabilir.
+// Üye biçimi: "<küçük harfli ad>\x00<ad>\x00<id>"
+const indexSeparator = "\x00"
+
+// Bulanık arama için her kullanıcı adı, sınır işaretleriyle çevrilmiş ikililerinin (bigram)
+// kümelerine de eklenir. Adaylar sorguyla yeterince ikili paylaşan adlardır; böylece ilk harfteki
+// yazım hataları da bulunur.
+const (
+	fuzzyMaxCandidates = 10000
+	fuzzyQueryTTL      = 10 * time.Second
+)
+
+// SearchHit is a username index entry
+type SearchHit struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	distance int
+}
+
+func usernameIndexMember(username string, id int) string {
+	return strings.ToLower(username) + indexSeparator + username + indexSeparator + strconv.Itoa(id)
+}
+
+func parseIndexMember(member string) (SearchHit, bool) {
+	parts := strings.Split(member, indexSeparator)
+	if len(parts) != 3 {
+		return SearchHit{}, false
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return SearchHit{}, false
+	}
+	return SearchHit{ID: id, Username: parts[1]}, true
+}
+
+// usernameGrams returns the distinct bigrams of a lowercased username padded with "^" and "$",
+// so the first and last letters form grams of their own
+func usernameGrams(lower string) []string {
+	runes := []rune("^" + lower + "$")
+	seen := make(map[string]bool, len(runes))
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		gram := string(runes[i : i+2])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// queueIndexUsername adds the username to the prefix index and its bigram sets
+func queueIndexUsername(pipe redis.Pipeliner, ctx context.Context, username string, id int) {
+	member := usernameIndexMember(username, id)
+	pipe.ZAdd(ctx, constants.UsernameIndex, &redis.Z{Score: 0, Member: member})
+	for _, gram := range usernameGrams(strings.ToLower(username)) {
+		pipe.ZAdd(ctx, constants.UsernameGramPrefix+gram, &redis.Z{Score: 1, Member: member})
+	}
+}
+
+// queueUnindexUsername removes the username from the prefix index and its bigram sets
+func queueUnindexUsername(pipe redis.Pipeliner, ctx context.Context, username string, id int) {
+	member := usernameIndexMember(username, id)
+	pipe.ZRem(ctx, constants.UsernameIndex, member)
+	for _, gram := range usernameGrams(strings.ToLower(username)) {
+		pipe.ZRem(ctx, constants.UsernameGramPrefix+gram, member)
+	}
+}
+
+// IndexUsername adds the username to the search index
+func IndexUsername(rdb *redis.Client, ctx context.Context, username string, id int) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		queueIndexUsername(pipe, ctx, username, id)
+		return nil
+	})
+	return err
+}
+
+// UnindexUsername removes the username from the search index
+func UnindexUsername(rdb *redis.Client, ctx context.Context, username string, id int) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		queueUnindexUsername(pipe, ctx, username, id)
+		return nil
+	})
+	return err
+}
+
+// RebuildUsernameIndex indexes every existing username:<name> key, for data written before the
+// index existed. It runs once.
+func RebuildUsernameIndex(rdb *redis.Client, ctx context.Context) error {
+	built, err := rdb.Exists(ctx, constants.UsernameIndexBuilt).Result()
+	if err != nil || built > 0 {
+		return err
+	}
+
+	iter := rdb.Scan(ctx, 0, constants.UsernamePrefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		idStr, err := rdb.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+
+		err = IndexUsername(rdb, ctx, strings.TrimPrefix(key, constants.UsernamePrefix), id)
+		if err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	return rdb.Set(ctx, constants.UsernameIndexBuilt, time.Now().Format(time.RFC3339), 0).Err()
+}
+
+// SearchUsernamesByPrefix returns index entries whose username starts with prefix, case-insensitively
+func SearchUsernamesByPrefix(rdb *redis.Client, ctx context.Context, prefix string, offset, count int) ([]SearchHit, error) {
+	prefix = strings.ToLower(prefix)
+	members, err := rdb.ZRangeByLex(ctx, constants.UsernameIndex, &redis.ZRangeBy{
+		Min:    "[" + prefix,
+		Max:    "[" + prefix + "\xff",
+		Offset: int64(offset),
+		Count:  int64(count),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, 0, len(members))
+	for _, member := range members {
+		if hit, ok := parseIndexMember(member); ok {
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// SearchUsernamesFuzzy returns every username within maxDistance edits of query, closest first.
+// Candidates are the usernames sharing enough bigrams with the query to be within maxDistance,
+// at most fuzzyMaxCandidates of them, best overlap first.
+func SearchUsernamesFuzzy(rdb *redis.Client, ctx context.Context, query string, maxDistance int) ([]SearchHit, error) {
+	query = strings.ToLower(query)
+	if query == "" {
+		return nil, nil
+	}
+	queryLen := utf8.RuneCountInString(query)
+
+	// Bir düzenleme en fazla iki ikiliyi bozar; daha azını paylaşan ad maxDistance içinde olamaz
+	grams := usernameGrams(query)
+	keys := make([]string, len(grams))
+	for i, gram := range grams {
+		keys[i] = constants.UsernameGramPrefix + gram
+	}
+	shared := len(grams) - 2*maxDistance
+	if shared < 1 {
+		shared = 1
+	}
+
+	tmp := constants.FuzzySearchPrefix + uuid.New().String()
+	var candidates *redis.StringSliceCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(ctx, tmp, &redis.ZStore{Keys: keys, Aggregate: "SUM"})
+		pipe.Expire(ctx, tmp, fuzzyQueryTTL)
+		candidates = pipe.ZRevRangeByScore(ctx, tmp, &redis.ZRangeBy{
+			Min:   strconv.Itoa(shared),
+			Max:   "+inf",
+			Count: fuzzyMaxCandidates,
+		})
+		pipe.Del(ctx, tmp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []SearchHit
+	for _, member := range candidates.Val() {
+		hit, ok := parseIndexMember(member)
+		if !ok {
+			continue
+		}
+		lower := strings.ToLower(hit.Username)
+		diff := utf8.RuneCountInString(lower) - queryLen
+		if diff > maxDistance || -diff > maxDistance {
+			continue
+		}
+		hit.distance = levenshtein(query, lower)
+		if hit.distance <= maxDistance {
+			matches = append(matches, hit)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return strings.ToLower(matches[i].Username) < strings.ToLower(matches[j].Username)
+	})
+	return matches, nil
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
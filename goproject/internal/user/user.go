@@ -6,19 +6,32 @@ import (
 	"errors"
 	"masomointern/internal/authent"
 	"masomointern/internal/constants"
+	"masomointern/internal/events"
 	"net/http"
+	"regexp"
 	"strconv"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-redis/redis/v8"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Surname  string `json:"surname"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	ID               int               `json:"id"`
+	Name             string            `json:"name"`
+	Surname          string            `json:"surname"`
+	Username         string            `json:"username"`
+	Password         string            `json:"password"`
+	DisplayName      string            `json:"display_name,omitempty"`
+	Bio              string            `json:"bio,omitempty"`
+	Country          string            `json:"country,omitempty"`
+	Language         string            `json:"language,omitempty"`
+	AvatarURL        string            `json:"avatar_url,omitempty"`
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails,omitempty"`
+	CreatedAt        string            `json:"created_at,omitempty"`
+	LastLoginAt      string            `json:"last_login_at,omitempty"`
+	DeletedAt        string            `json:"deleted_at,omitempty"`
 }
 
 type Response struct {
@@ -27,6 +40,52 @@ type Response struct {
 	Message string      `json:"message"`
 }
 
+// ErrUserNotFound is returned when no user:<id> record exists
+var ErrUserNotFound = errors.New("User not found")
+
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 280
+)
+
+var (
+	countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)             // ISO 3166-1 alpha-2, ör. TR
+	languagePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`) // ör. tr veya en-US
+)
+
+// validateProfile checks the optional profile fields of a user
+func validateProfile(u User) error {
+	if utf8.RuneCountInString(u.DisplayName) > MaxDisplayNameLength {
+		return errors.New("Display name is too long")
+	}
+	if utf8.RuneCountInString(u.Bio) > MaxBioLength {
+		return errors.New("Bio is too long")
+	}
+	if u.Country != "" && !countryPattern.MatchString(u.Country) {
+		return errors.New("Country must be a two-letter ISO 3166 code")
+	}
+	if u.Language != "" && !languagePattern.MatchString(u.Language) {
+		return errors.New("Language must be a code such as en or en-US")
+	}
+	return nil
+}
+
+// PublicProfile returns a copy of the user without private fields such as the password
+func PublicProfile(u User) User {
+	return User{
+		Name:             u.Name,
+		Surname:          u.Surname,
+		Username:         u.Username,
+		DisplayName:      u.DisplayName,
+		Bio:              u.Bio,
+		Country:          u.Country,
+		Language:         u.Language,
+		AvatarURL:        u.AvatarURL,
+		AvatarThumbnails: u.AvatarThumbnails,
+		CreatedAt:        u.CreatedAt,
+	}
+}
+
 func passwordToHash(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
@@ -56,6 +115,12 @@ func RegisterHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
 			return
 		}
 
+		err = validateProfile(newUser)
+		if err != nil {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: err.Error()})
+			return
+		}
+
 		existingUsername, err := rdb.Get(ctx, constants.UsernamePrefix+newUser.Username).Result()
 		if err != redis.Nil && err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -74,6 +139,10 @@ func RegisterHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
 		}
 
 		newUser.Password = hashedPassword
+		newUser.AvatarURL = ""
+		newUser.AvatarThumbnails = nil
+		newUser.CreatedAt = time.Now().Format(time.RFC3339)
+		newUser.LastLoginAt = ""
 
 		id, err := rdb.Incr(ctx, constants.NextUserID).Result()
 		if err != nil {
@@ -88,17 +157,19 @@ func RegisterHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		err = rdb.Set(ctx, constants.UserPrefix+strconv.Itoa(newUser.ID), userJson, 0).Err()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		err = rdb.Set(ctx, constants.UsernamePrefix+newUser.Username, strconv.Itoa(newUser.ID), 0).Err()
+		// Kullanıcı kaydı, kullanıcı adı, arama indeksi ve olay tek MULTI içinde yazılır
+		_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, constants.UserPrefix+strconv.Itoa(newUser.ID), userJson, 0)
+			pipe.Set(ctx, constants.UsernamePrefix+newUser.Username, strconv.Itoa(newUser.ID), 0)
+			queueIndexUsername(pipe, ctx, newUser.Username, newUser.ID)
+			return events.QueuePublish(pipe, ctx, events.UserRegistered, events.UserRegisteredData{UserID: newUser.ID, Username: newUser.Username})
+		})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		// Kayıt öncesinde önbelleğe "bulunamadı" olarak girmiş olabilir
+		InvalidateProfile(newUser.ID)
 
 		// Token oluşturma
 		token, err := authent.GenerateToken(rdb, ctx, newUser.ID)
@@ -107,13 +178,7 @@ func RegisterHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		responseUser := User{
-			Name:     newUser.Name,
-			Surname:  newUser.Surname,
-			Username: newUser.Username,
-		}
-
-		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"user": responseUser, "token": token}})
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"user": PublicProfile(newUser), "token": token}})
 	}
 }
 
@@ -169,13 +234,46 @@ func LoginHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		responseUser := User{
-			Name:     user.Name,
-			Surname:  user.Surname,
-			Username: user.Username,
+		// Silinmeyi bekleyen hesaba giriş yapılırsa silme işlemi iptal edilir
+		if user.DeletedAt != "" {
+			err = cancelDeletion(rdb, ctx, &user)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		user.LastLoginAt = time.Now().Format(time.RFC3339)
+		err = SaveUser(rdb, ctx, user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"user": responseUser, "token": token}})
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{"user": PublicProfile(user), "token": token}})
+	}
+}
+
+// StreamTicketHandler issues a short-lived, single-use ticket for the live leaderboard and
+// notification streams, which clients pass as the ticket query parameter
+func StreamTicketHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authent.GetUserIDFromToken(rdb, ctx, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ticket, err := authent.GenerateStreamTicket(rdb, ctx, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: map[string]interface{}{
+			"ticket":     ticket,
+			"expires_in": int(authent.TicketTTL.Seconds()),
+		}})
 	}
 }
 
@@ -203,13 +301,12 @@ func UserDetailsHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 			return
 		}
 
-		responseUser := User{
-			Name:     user.Name,
-			Surname:  user.Surname,
-			Username: user.Username,
+		if user.DeletedAt != "" {
+			http.Error(w, "User not found!", http.StatusNotFound)
+			return
 		}
 
-		json.NewEncoder(w).Encode(Response{Status: true, Result: responseUser})
+		json.NewEncoder(w).Encode(Response{Status: true, Result: PublicProfile(user)})
 	}
 }
 
@@ -234,6 +331,12 @@ func UpdateInfoHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 			return
 		}
 
+		err = validateProfile(updatedUser)
+		if err != nil {
+			json.NewEncoder(w).Encode(Response{Status: false, Message: err.Error()})
+			return
+		}
+
 		if userID != updatedUser.ID {
 			http.Error(w, "Cannot change another user's information", http.StatusForbidden)
 			return
@@ -290,12 +393,28 @@ func UpdateInfoHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+
+			err = UnindexUsername(rdb, ctx, existingUser.Username, existingUser.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			err = IndexUsername(rdb, ctx, updatedUser.Username, existingUser.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 
 		// Diğer alanların güncellenmesi
 		existingUser.Name = updatedUser.Name
 		existingUser.Surname = updatedUser.Surname
 		existingUser.Username = updatedUser.Username
+		existingUser.DisplayName = updatedUser.DisplayName
+		existingUser.Bio = updatedUser.Bio
+		existingUser.Country = updatedUser.Country
+		existingUser.Language = updatedUser.Language
 
 		if updatedUser.Password != "" {
 			hashedPassword, err := passwordToHash(updatedUser.Password)
@@ -317,6 +436,7 @@ func UpdateInfoHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		InvalidateProfile(existingUser.ID)
 
 		json.NewEncoder(w).Encode(Response{Status: true, Result: existingUser})
 	}
@@ -325,7 +445,7 @@ func UpdateInfoHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc
 func GetUserByID(rdb *redis.Client, ctx context.Context, id int) (User, error) {
 	userJson, err := rdb.Get(ctx, constants.UserPrefix+strconv.Itoa(id)).Result() //constants
 	if err == redis.Nil {
-		return User{}, errors.New("User not found")
+		return User{}, ErrUserNotFound
 	} else if err != nil {
 		return User{}, err
 	}
@@ -349,6 +469,71 @@ func SaveUser(rdb *redis.Client, ctx context.Context, user User) error {
 	if err != nil {
 		return err
 	}
+	InvalidateProfile(user.ID)
 
 	return nil
 }
+
+// GetUsersByIDs fetches several users with a single MGET; IDs without a record are left out of the map
+func GetUsersByIDs(rdb *redis.Client, ctx context.Context, ids []int) (map[int]User, error) {
+	users := make(map[int]User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = constants.UserPrefix + strconv.Itoa(id)
+	}
+
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		userJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var u User
+		err = json.Unmarshal([]byte(userJSON), &u)
+		if err != nil {
+			return nil, err
+		}
+		users[ids[i]] = u
+	}
+	return users, nil
+}
+
+// GetUserIDsByUsernames resolves usernames to IDs with a single MGET; unknown usernames are left out of the map
+func GetUserIDsByUsernames(rdb *redis.Client, ctx context.Context, usernames []string) (map[string]int, error) {
+	ids := make(map[string]int, len(usernames))
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = constants.UsernamePrefix + username
+	}
+
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		idStr, ok := value.(string)
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		ids[usernames[i]] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,532 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/events"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Teslimat durumları
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+var (
+	// MaxAttempts, bir teslimatın başarısız sayılmadan önce en fazla kaç kez deneneceği
+	MaxAttempts = 6
+
+	// RetryDelay, ilk yeniden denemeden önce beklenen süre; her denemede iki katına çıkar
+	RetryDelay = 30 * time.Second
+
+	// MaxRetryDelay, iki deneme arasındaki en uzun bekleme
+	MaxRetryDelay = time.Hour
+
+	// DeliveryRetention, teslimat kayıtlarının saklanma süresi
+	DeliveryRetention = 30 * 24 * time.Hour
+
+	// MaxDeliveryLog, her webhook için listelenen en fazla teslimat
+	MaxDeliveryLog int64 = 1000
+
+	// Client, teslimatlarda kullanılan HTTP istemcisi
+	Client = &http.Client{Timeout: 10 * time.Second}
+
+	// DeliveryLease, alınan bir teslimatın işlenmesi için verilen süre; dolduğunda teslimat başka
+	// bir sunucu tarafından yeniden alınabilir. Client.Timeout'tan uzun olmalıdır.
+	DeliveryLease = 2 * time.Minute
+
+	// DeliveryWorkers, aynı anda teslimat yapılan en fazla webhook sayısı
+	DeliveryWorkers = 8
+)
+
+const (
+	// maxResponseLog, teslimat kaydında tutulan yanıt gövdesi uzunluğu
+	maxResponseLog = 512
+
+	// deliveryBatch, bir turda alınan en fazla teslimat
+	deliveryBatch = 100
+)
+
+// enqueueScript, teslimat kaydını yoksa oluşturur; kayıt, günlük ve kuyruk girdisi birlikte yazılır
+var enqueueScript = redis.NewScript(`
+if not redis.call("SET", KEYS[1], ARGV[2], "EX", ARGV[3], "NX") then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[1])
+redis.call("ZREMRANGEBYRANK", KEYS[2], 0, -tonumber(ARGV[6]) - 1)
+redis.call("EXPIRE", KEYS[2], ARGV[3])
+redis.call("ZADD", KEYS[3], ARGV[5], ARGV[1])
+return 1
+`)
+
+// claimScript, vadesi gelen teslimatları kira süresinin sonuna taşıyarak alır
+var claimScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call("ZADD", KEYS[1], ARGV[2], id)
+end
+return due
+`)
+
+// Attempt, bir teslimat denemesinin kaydı
+type Attempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Response   string `json:"response,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Delivery, bir olayın bir webhook'a gönderimi ve denemeleri
+type Delivery struct {
+	ID          string          `json:"id"`
+	WebhookID   int             `json:"webhook_id"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    []Attempt       `json:"attempts"`
+	NextAttempt string          `json:"next_attempt,omitempty"`
+	ReplayOf    string          `json:"replay_of,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the wait before the next attempt after attempts failed ones
+func backoff(attempts int) time.Duration {
+	delay := RetryDelay
+	for i := 1; i < attempts && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	return delay
+}
+
+func deliveryKey(id string) string {
+	return constants.WebhookDeliveryPrefix + id
+}
+
+// GetDelivery loads a delivery record
+func GetDelivery(rdb *redis.Client, ctx context.Context, id string) (Delivery, error) {
+	dJSON, err := rdb.Get(ctx, deliveryKey(id)).Result()
+	if err == redis.Nil {
+		return Delivery{}, ErrDeliveryNotFound
+	} else if err != nil {
+		return Delivery{}, err
+	}
+
+	var d Delivery
+	err = json.Unmarshal([]byte(dJSON), &d)
+	return d, err
+}
+
+// saveDelivery writes a delivery record
+func saveDelivery(c redis.Cmdable, ctx context.Context, d Delivery) error {
+	dJSON, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, deliveryKey(d.ID), dJSON, DeliveryRetention).Err()
+}
+
+// enqueue stores a new delivery, adds it to the webhook's log and queues it for sending. A
+// delivery whose ID already exists is skipped, so an event delivered twice by the bus is sent
+// once; the record and its queue entry are written by one script, so neither exists without the other.
+func enqueue(rdb *redis.Client, ctx context.Context, d Delivery) (bool, error) {
+	dJSON, err := json.Marshal(d)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	logKey := constants.WebhookDeliveriesPrefix + strconv.Itoa(d.WebhookID)
+	created, err := enqueueScript.Run(ctx, rdb,
+		[]string{deliveryKey(d.ID), logKey, constants.WebhookQueue},
+		d.ID, dJSON, int64(DeliveryRetention.Seconds()), now.UnixNano(), now.Unix(), MaxDeliveryLog).Int()
+	return created == 1, err
+}
+
+// payload, alıcıya gönderilen JSON gövdesi
+type payload struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt string          `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// RegisterEventHandlers subscribes webhooks to every published event type; matching webhooks
+// get a queued delivery per event
+func RegisterEventHandlers(rdb *redis.Client) {
+	events.Subscribe("webhooks", func(ctx context.Context, e events.Event) error {
+		list, err := List(rdb, ctx)
+		if err != nil {
+			return err
+		}
+
+		body, err := json.Marshal(payload{ID: e.ID, Type: e.Type, OccurredAt: e.OccurredAt, Data: e.Data})
+		if err != nil {
+			return err
+		}
+		for _, wh := range list {
+			if !wh.subscribed(e.Type) {
+				continue
+			}
+			_, err := enqueue(rdb, ctx, Delivery{
+				ID:        strconv.Itoa(wh.ID) + "-" + e.ID,
+				WebhookID: wh.ID,
+				EventID:   e.ID,
+				EventType: e.Type,
+				Payload:   body,
+				Status:    StatusPending,
+				Attempts:  []Attempt{},
+				CreatedAt: time.Now().Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, events.Types...)
+}
+
+// send posts a delivery's payload once and returns the attempt's record
+func send(wh Webhook, d Delivery) Attempt {
+	started := time.Now()
+	attempt := Attempt{At: started.Format(time.RFC3339)}
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "masomointern-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(wh.ID))
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Delivery", d.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", Sign(wh.Secret, timestamp, d.Payload))
+
+	resp, err := Client.Do(req)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	attempt.Response = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = resp.Status
+	}
+	return attempt
+}
+
+// record appends an attempt to the delivery and updates its status. It returns when the next
+// attempt is due, or the zero time if the delivery was delivered or has run out of attempts.
+func (d *Delivery) record(attempt Attempt, now time.Time) time.Time {
+	d.Attempts = append(d.Attempts, attempt)
+	d.NextAttempt = ""
+
+	switch {
+	case attempt.Error == "":
+		d.Status = StatusDelivered
+	case len(d.Attempts) >= MaxAttempts:
+		d.Status = StatusFailed
+	default:
+		next := now.Add(backoff(len(d.Attempts)))
+		d.NextAttempt = next.Format(time.RFC3339)
+		return next
+	}
+	return time.Time{}
+}
+
+// replay returns a pending copy of the delivery with its own ID and no attempts
+func (d Delivery) replay(now time.Time) Delivery {
+	copied := d
+	copied.ID = d.ID + "-replay-" + strconv.FormatInt(now.UnixNano(), 36)
+	copied.Status = StatusPending
+	copied.Attempts = []Attempt{}
+	copied.NextAttempt = ""
+	copied.ReplayOf = d.ID
+	copied.CreatedAt = now.Format(time.RFC3339)
+	return copied
+}
+
+// finish saves a delivery after an attempt and removes it from the queue, or moves it to its
+// next attempt if next is set
+func finish(rdb *redis.Client, ctx context.Context, d Delivery, next time.Time) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := saveDelivery(pipe, ctx, d); err != nil {
+			return err
+		}
+		if next.IsZero() {
+			pipe.ZRem(ctx, constants.WebhookQueue, d.ID)
+		} else {
+			pipe.ZAdd(ctx, constants.WebhookQueue, &redis.Z{Score: float64(next.Unix()), Member: d.ID})
+		}
+		return nil
+	})
+	return err
+}
+
+// release makes claimed deliveries due again without attempting them
+func release(rdb *redis.Client, ctx context.Context, list []Delivery) {
+	if len(list) == 0 {
+		return
+	}
+	now := float64(time.Now().Unix())
+	members := make([]*redis.Z, len(list))
+	for i, d := range list {
+		members[i] = &redis.Z{Score: now, Member: d.ID}
+	}
+	err := rdb.ZAddXX(ctx, constants.WebhookQueue, members...).Err()
+	if err != nil {
+		// Kira süresi dolunca yine alınırlar
+		log.Printf("Webhook deliveries could not be released: %v", err)
+	}
+}
+
+// deliverGroup sends one webhook's claimed deliveries in order. After a failed attempt the rest
+// are released for the next round rather than each waiting on the same receiver, and no attempt
+// is started that could outlast the lease.
+func deliverGroup(rdb *redis.Client, ctx context.Context, list []Delivery, claimed time.Time) {
+	wh, err := Get(rdb, ctx, list[0].WebhookID)
+	if err != nil && err != ErrWebhookNotFound {
+		log.Printf("Webhook %d could not be loaded: %v", list[0].WebhookID, err)
+		return
+	}
+
+	for i, d := range list {
+		if err == ErrWebhookNotFound {
+			d.Status = StatusFailed
+			d.NextAttempt = ""
+			d.Attempts = append(d.Attempts, Attempt{At: time.Now().Format(time.RFC3339), Error: "Webhook deleted"})
+			if err := finish(rdb, ctx, d, time.Time{}); err != nil {
+				log.Printf("Webhook delivery %s could not be saved: %v", d.ID, err)
+			}
+			continue
+		}
+		if time.Since(claimed)+Client.Timeout >= DeliveryLease {
+			release(rdb, ctx, list[i:])
+			return
+		}
+
+		attempt := send(wh, d)
+		next := d.record(attempt, time.Now())
+		if d.Status == StatusFailed {
+			log.Printf("Webhook delivery %s failed after %d attempts: %s", d.ID, len(d.Attempts), attempt.Error)
+		}
+		// Kaydedilemeyen teslimat kira süresi dolunca yeniden denenir
+		if err := finish(rdb, ctx, d, next); err != nil {
+			log.Printf("Webhook delivery %s could not be saved: %v", d.ID, err)
+		}
+		if attempt.Error != "" {
+			release(rdb, ctx, list[i+1:])
+			return
+		}
+	}
+}
+
+// claim leases up to deliveryBatch due deliveries and loads them. Leased deliveries stay in the
+// queue, scored at the end of the lease, so those left unfinished by a crashed instance are
+// attempted again once it runs out.
+func claim(rdb *redis.Client, ctx context.Context, now time.Time) ([]Delivery, error) {
+	ids, err := claimScript.Run(ctx, rdb, []string{constants.WebhookQueue},
+		now.Unix(), now.Add(DeliveryLease).Unix(), deliveryBatch).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = deliveryKey(id)
+	}
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Delivery, 0, len(values))
+	for i, value := range values {
+		dJSON, ok := value.(string)
+		if !ok {
+			// Saklama süresi dolmuş teslimat kuyruktan çıkarılır
+			rdb.ZRem(ctx, constants.WebhookQueue, ids[i])
+			continue
+		}
+		var d Delivery
+		if err := json.Unmarshal([]byte(dJSON), &d); err != nil {
+			log.Printf("Webhook delivery %s could not be read: %v", ids[i], err)
+			continue
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// processDue claims the due deliveries and sends each webhook's share on its own goroutine, at
+// most DeliveryWorkers at a time, so a slow receiver only holds up its own deliveries
+func processDue(rdb *redis.Client, ctx context.Context) {
+	claimed := time.Now()
+	list, err := claim(rdb, ctx, claimed)
+	if err != nil {
+		log.Printf("Webhook queue could not be read: %v", err)
+		return
+	}
+
+	groups := map[int][]Delivery{}
+	var order []int
+	for _, d := range list {
+		if _, ok := groups[d.WebhookID]; !ok {
+			order = append(order, d.WebhookID)
+		}
+		groups[d.WebhookID] = append(groups[d.WebhookID], d)
+	}
+
+	workers := make(chan struct{}, DeliveryWorkers)
+	var wg sync.WaitGroup
+	for _, id := range order {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(group []Delivery) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			deliverGroup(rdb, ctx, group, claimed)
+		}(groups[id])
+	}
+	wg.Wait()
+}
+
+// StartDeliveryWorker sends queued webhook deliveries
+func StartDeliveryWorker(rdb *redis.Client, ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			processDue(rdb, ctx)
+		}
+	}()
+}
+
+// DeliveriesHandler lists a webhook's deliveries with their attempts, newest first
+func DeliveriesHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		id, err := webhookIDParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 1 || count > 100 {
+			count = 20
+		}
+		start := int64((page - 1) * count)
+
+		ids, err := rdb.ZRevRange(ctx, constants.WebhookDeliveriesPrefix+strconv.Itoa(id), start, start+int64(count)-1).Result()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		deliveries := make([]Delivery, 0, len(ids))
+		for _, deliveryID := range ids {
+			d, err := GetDelivery(rdb, ctx, deliveryID)
+			if err == ErrDeliveryNotFound {
+				continue
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			deliveries = append(deliveries, d)
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: deliveries})
+	}
+}
+
+// ReplayHandler queues a copy of an earlier delivery with the same payload. The copy is signed
+// with the webhook's current secret and gets its own delivery ID.
+func ReplayHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		var request struct {
+			DeliveryID string `json:"delivery_id"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		original, err := GetDelivery(rdb, ctx, request.DeliveryID)
+		if err == ErrDeliveryNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := Get(rdb, ctx, original.WebhookID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrWebhookNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		replay := original.replay(time.Now())
+
+		_, err = enqueue(rdb, ctx, replay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: replay, Message: "Delivery queued for replay"})
+	}
+}
@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"masomointern/internal/constants"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// receiver, gelen istekleri kaydeden ve sırayla verilen durum kodlarıyla yanıtlayan test alıcısı
+type receiver struct {
+	server   *httptest.Server
+	statuses []int
+	calls    int64
+	requests chan *http.Request
+	bodies   chan []byte
+}
+
+// newReceiver starts a receiver answering its nth request with statuses[n], repeating the last
+// status once they run out
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses, requests: make(chan *http.Request, 100), bodies: make(chan []byte, 100)}
+	rc.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt64(&rc.calls, 1)) - 1
+		body, _ := io.ReadAll(r.Body)
+		rc.requests <- r
+		rc.bodies <- body
+
+		status := rc.statuses[len(rc.statuses)-1]
+		if n < len(rc.statuses) {
+			status = rc.statuses[n]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(strings.Repeat("e", maxResponseLog*2)))
+	}))
+	t.Cleanup(rc.server.Close)
+	return rc
+}
+
+func testDelivery(webhookID int) Delivery {
+	body, _ := json.Marshal(payload{ID: "1-0", Type: "match.reported", Data: json.RawMessage(`{"match_id":7}`)})
+	return Delivery{
+		ID:        strconv.Itoa(webhookID) + "-1-0",
+		WebhookID: webhookID,
+		EventID:   "1-0",
+		EventType: "match.reported",
+		Payload:   body,
+		Status:    StatusPending,
+		Attempts:  []Attempt{},
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	rc := newReceiver(t, http.StatusOK)
+	wh := Webhook{ID: 3, URL: rc.server.URL, Secret: "s3cret"}
+	d := testDelivery(wh.ID)
+
+	attempt := send(wh, d)
+	if attempt.Error != "" || attempt.StatusCode != http.StatusOK {
+		t.Fatalf("attempt = %+v, want success", attempt)
+	}
+
+	r, body := <-rc.requests, <-rc.bodies
+	if string(body) != string(d.Payload) {
+		t.Fatalf("body = %s, want %s", body, d.Payload)
+	}
+	// Alıcının yapacağı gibi imza gizli anahtarla baştan hesaplanır
+	timestamp := r.Header.Get("X-Webhook-Timestamp")
+	mac := hmac.New(sha256.New, []byte(wh.Secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.Header.Get("X-Webhook-Signature"); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if got := Sign("other", timestamp, body); got == want {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if r.Header.Get("X-Webhook-Delivery") != d.ID || r.Header.Get("X-Webhook-Event") != d.EventType {
+		t.Fatalf("headers = %v", r.Header)
+	}
+}
+
+func TestSendRecordsFailure(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError)
+
+	attempt := send(Webhook{ID: 3, URL: rc.server.URL}, testDelivery(3))
+	if attempt.StatusCode != http.StatusInternalServerError || attempt.Error == "" {
+		t.Fatalf("attempt = %+v, want a failed 500", attempt)
+	}
+	if len(attempt.Response) != maxResponseLog {
+		t.Fatalf("response log has %d bytes, want %d", len(attempt.Response), maxResponseLog)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, RetryDelay},
+		{2, 2 * RetryDelay},
+		{3, 4 * RetryDelay},
+		{20, MaxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryUntilDelivered(t *testing.T) {
+	rc := newReceiver(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusNoContent)
+	wh := Webhook{ID: 3, URL: rc.server.URL}
+	d := testDelivery(wh.ID)
+	now := time.Now()
+
+	for i := 1; i <= 2; i++ {
+		next := d.record(send(wh, d), now)
+		if d.Status != StatusPending || !next.Equal(now.Add(backoff(i))) {
+			t.Fatalf("after failure %d: status %s, next %v", i, d.Status, next)
+		}
+	}
+	if next := d.record(send(wh, d), now); !next.IsZero() || d.Status != StatusDelivered {
+		t.Fatalf("status = %s, next = %v, want delivered", d.Status, next)
+	}
+	if len(d.Attempts) != 3 || d.NextAttempt != "" {
+		t.Fatalf("attempts = %d, next attempt = %q", len(d.Attempts), d.NextAttempt)
+	}
+}
+
+func TestFailureAfterMaxAttempts(t *testing.T) {
+	rc := newReceiver(t, http.StatusBadGateway)
+	wh := Webhook{ID: 3, URL: rc.server.URL}
+	d := testDelivery(wh.ID)
+
+	for i := 1; i <= MaxAttempts; i++ {
+		next := d.record(send(wh, d), time.Now())
+		if i < MaxAttempts && (d.Status != StatusPending || next.IsZero()) {
+			t.Fatalf("attempt %d: status %s, want pending with a next attempt", i, d.Status)
+		}
+		if i == MaxAttempts && (d.Status != StatusFailed || !next.IsZero()) {
+			t.Fatalf("attempt %d: status %s, want failed", i, d.Status)
+		}
+	}
+	if got := atomic.LoadInt64(&rc.calls); got != int64(MaxAttempts) {
+		t.Fatalf("receiver got %d requests, want %d", got, MaxAttempts)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rc := newReceiver(t, http.StatusOK)
+	original := testDelivery(3)
+	original.record(Attempt{Error: "500 Internal Server Error"}, time.Now())
+
+	replay := original.replay(time.Now())
+	if replay.ID == original.ID || !strings.HasPrefix(replay.ID, original.ID+"-replay-") {
+		t.Fatalf("replay ID = %q", replay.ID)
+	}
+	if replay.ReplayOf != original.ID || replay.Status != StatusPending || len(replay.Attempts) != 0 || replay.NextAttempt != "" {
+		t.Fatalf("replay = %+v", replay)
+	}
+	if len(original.Attempts) != 1 {
+		t.Fatal("replay changed the original's attempts")
+	}
+
+	// Kopya, webhook'un güncel anahtarıyla imzalanır
+	wh := Webhook{ID: 3, URL: rc.server.URL, Secret: "rotated"}
+	if attempt := send(wh, replay); attempt.Error != "" {
+		t.Fatalf("attempt = %+v", attempt)
+	}
+	r, body := <-rc.requests, <-rc.bodies
+	if string(body) != string(original.Payload) || r.Header.Get("X-Webhook-Delivery") != replay.ID {
+		t.Fatalf("replay sent %s as %s", body, r.Header.Get("X-Webhook-Delivery"))
+	}
+	if r.Header.Get("X-Webhook-Signature") != Sign("rotated", r.Header.Get("X-Webhook-Timestamp"), body) {
+		t.Fatal("replay is not signed with the current secret")
+	}
+}
+
+// testRedis connects to the scratch Redis given by TEST_REDIS_ADDR; database 15 is flushed
+func testRedis(t *testing.T) (*redis.Client, context.Context) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	if err := rdb.FlushDB(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rdb, ctx
+}
+
+func saveWebhook(t *testing.T, rdb *redis.Client, ctx context.Context, wh Webhook) {
+	whJSON, _ := json.Marshal(wh)
+	if err := rdb.Set(ctx, constants.WebhookPrefix+strconv.Itoa(wh.ID), whJSON, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimLeasesDeliveries(t *testing.T) {
+	rdb, ctx := testRedis(t)
+	d := testDelivery(3)
+	if _, err := enqueue(rdb, ctx, d); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	list, err := claim(rdb, ctx, now)
+	if err != nil || len(list) != 1 || list[0].ID != d.ID {
+		t.Fatalf("claim = %v, %v", list, err)
+	}
+	// Alınan teslimat kuyrukta kalır; süresi dolana kadar yeniden alınamaz
+	score, err := rdb.ZScore(ctx, constants.WebhookQueue, d.ID).Result()
+	if err != nil || int64(score) != now.Add(DeliveryLease).Unix() {
+		t.Fatalf("score = %v, %v, want the end of the lease", score, err)
+	}
+	if list, _ := claim(rdb, ctx, now); len(list) != 0 {
+		t.Fatal("leased delivery was claimed twice")
+	}
+	if list, _ := claim(rdb, ctx, now.Add(DeliveryLease)); len(list) != 1 {
+		t.Fatal("delivery was not claimed again after the lease ran out")
+	}
+}
+
+func TestProcessDue(t *testing.T) {
+	rdb, ctx := testRedis(t)
+	timeout := Client.Timeout
+	Client.Timeout = 200 * time.Millisecond
+	defer func() { Client.Timeout = timeout }()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+	fast, failing := newReceiver(t, http.StatusOK), newReceiver(t, http.StatusInternalServerError)
+	saveWebhook(t, rdb, ctx, Webhook{ID: 1, URL: slow.URL})
+	saveWebhook(t, rdb, ctx, Webhook{ID: 2, URL: fast.server.URL})
+	saveWebhook(t, rdb, ctx, Webhook{ID: 3, URL: failing.server.URL})
+
+	var slowIDs []string
+	for i := 0; i < 5; i++ {
+		d := testDelivery(1)
+		d.ID += "-" + strconv.Itoa(i)
+		slowIDs = append(slowIDs, d.ID)
+		enqueue(rdb, ctx, d)
+	}
+	enqueue(rdb, ctx, testDelivery(2))
+	enqueue(rdb, ctx, testDelivery(3))
+
+	started := time.Now()
+	processDue(rdb, ctx)
+	// Yanıt vermeyen alıcı yalnızca bir zaman aşımı kadar bekletir
+	if elapsed := time.Since(started); elapsed > 2*Client.Timeout+500*time.Millisecond {
+		t.Fatalf("processDue took %v", elapsed)
+	}
+
+	delivered, _ := GetDelivery(rdb, ctx, testDelivery(2).ID)
+	if delivered.Status != StatusDelivered {
+		t.Fatalf("fast receiver's delivery is %s", delivered.Status)
+	}
+	if _, err := rdb.ZScore(ctx, constants.WebhookQueue, delivered.ID).Result(); err != redis.Nil {
+		t.Fatal("delivered delivery is still queued")
+	}
+
+	retry, _ := GetDelivery(rdb, ctx, testDelivery(3).ID)
+	score, _ := rdb.ZScore(ctx, constants.WebhookQueue, retry.ID).Result()
+	if retry.Status != StatusPending || len(retry.Attempts) != 1 || int64(score) < started.Add(RetryDelay).Unix() {
+		t.Fatalf("failed delivery: %+v, queued at %v", retry, score)
+	}
+
+	// Zaman aşımına uğrayan ilk teslimattan sonrakiler denenmeden sıraya geri bırakılır
+	first, _ := GetDelivery(rdb, ctx, slowIDs[0])
+	if len(first.Attempts) != 1 {
+		t.Fatalf("slow delivery has %d attempts", len(first.Attempts))
+	}
+	for _, id := range slowIDs[1:] {
+		d, _ := GetDelivery(rdb, ctx, id)
+		score, _ := rdb.ZScore(ctx, constants.WebhookQueue, id).Result()
+		if len(d.Attempts) != 0 || int64(score) > time.Now().Unix() {
+			t.Fatalf("delivery %s: %d attempts, queued at %v", id, len(d.Attempts), score)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"masomointern/internal/authent"
+	"masomointern/internal/constants"
+	"masomointern/internal/events"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Response struct {
+	Status  bool        `json:"status"`
+	Result  interface{} `json:"result"`
+	Message string      `json:"message"`
+}
+
+// Webhook, olayların gönderildiği bir dış adres aboneliği
+type Webhook struct {
+	ID        int      `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"` // Yalnızca oluşturulurken döndürülür
+	CreatedAt string   `json:"created_at"`
+}
+
+var (
+	ErrWebhookNotFound  = errors.New("Webhook not found")
+	ErrDeliveryNotFound = errors.New("Webhook delivery not found")
+)
+
+// public returns the webhook without its secret
+func (wh Webhook) public() Webhook {
+	wh.Secret = ""
+	return wh
+}
+
+// subscribed reports whether the webhook receives events of the given type
+func (wh Webhook) subscribed(eventType string) bool {
+	for _, t := range wh.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the URL and event types of a new webhook
+func validate(wh Webhook) error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL must be an absolute http or https address")
+	}
+	if len(wh.Events) == 0 {
+		return errors.New("At least one event type is required")
+	}
+	for _, t := range wh.Events {
+		known := false
+		for _, k := range events.Types {
+			if t == k {
+				known = true
+			}
+		}
+		if !known {
+			return errors.New("Unknown event type " + t)
+		}
+	}
+	return nil
+}
+
+// newSecret returns a random signing secret
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Get loads a webhook including its secret
+func Get(rdb *redis.Client, ctx context.Context, id int) (Webhook, error) {
+	whJSON, err := rdb.Get(ctx, constants.WebhookPrefix+strconv.Itoa(id)).Result()
+	if err == redis.Nil {
+		return Webhook{}, ErrWebhookNotFound
+	} else if err != nil {
+		return Webhook{}, err
+	}
+
+	var wh Webhook
+	err = json.Unmarshal([]byte(whJSON), &wh)
+	return wh, err
+}
+
+// List loads every webhook including secrets, ordered by ID
+func List(rdb *redis.Client, ctx context.Context) ([]Webhook, error) {
+	ids, err := rdb.ZRange(ctx, constants.Webhooks, 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return []Webhook{}, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = constants.WebhookPrefix + id
+	}
+	values, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Webhook, 0, len(values))
+	for _, value := range values {
+		whJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var wh Webhook
+		if err := json.Unmarshal([]byte(whJSON), &wh); err != nil {
+			return nil, err
+		}
+		list = append(list, wh)
+	}
+	return list, nil
+}
+
+// Create stores a new webhook, generating a secret if none is given
+func Create(rdb *redis.Client, ctx context.Context, wh Webhook) (Webhook, error) {
+	if err := validate(wh); err != nil {
+		return Webhook{}, err
+	}
+	if wh.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return Webhook{}, err
+		}
+		wh.Secret = secret
+	}
+
+	id, err := rdb.Incr(ctx, constants.NextWebhookID).Result()
+	if err != nil {
+		return Webhook{}, err
+	}
+	wh.ID = int(id)
+	wh.CreatedAt = time.Now().Format(time.RFC3339)
+
+	whJSON, err := json.Marshal(wh)
+	if err != nil {
+		return Webhook{}, err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, constants.WebhookPrefix+strconv.Itoa(wh.ID), whJSON, 0)
+		pipe.ZAdd(ctx, constants.Webhooks, &redis.Z{Score: float64(wh.ID), Member: strconv.Itoa(wh.ID)})
+		return nil
+	})
+	return wh, err
+}
+
+// Delete removes a webhook; its delivery logs expire on their own and queued deliveries are dropped
+func Delete(rdb *redis.Client, ctx context.Context, id int) error {
+	removed, err := rdb.ZRem(ctx, constants.Webhooks, strconv.Itoa(id)).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrWebhookNotFound
+	}
+	return rdb.Del(ctx, constants.WebhookPrefix+strconv.Itoa(id)).Err()
+}
+
+// webhookIDParam reads the id query parameter
+func webhookIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("Invalid webhook ID")
+	}
+	return id, nil
+}
+
+// WebhooksHandler lists the webhook subscriptions without their secrets.
+// Only callers with the service credential may manage webhooks.
+func WebhooksHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		list, err := List(rdb, ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range list {
+			list[i] = list[i].public()
+		}
+		json.NewEncoder(w).Encode(Response{Status: true, Result: list})
+	}
+}
+
+// CreateWebhookHandler adds a webhook subscription. The signing secret is returned only in
+// this response; it is generated when the request leaves it empty.
+func CreateWebhookHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		var request Webhook
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = validate(request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wh, err := Create(rdb, ctx, Webhook{URL: request.URL, Events: request.Events, Secret: request.Secret})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Result: wh, Message: "Webhook created"})
+	}
+}
+
+// DeleteWebhookHandler removes the webhook given by the id query parameter
+func DeleteWebhookHandler(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authent.IsServiceRequest(r) {
+			http.Error(w, "Service credential required", http.StatusForbidden)
+			return
+		}
+
+		id, err := webhookIDParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = Delete(rdb, ctx, id)
+		if err == ErrWebhookNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(Response{Status: true, Message: "Webhook deleted"})
+	}
+}
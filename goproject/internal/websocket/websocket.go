@@ -0,0 +1,285 @@
+// Package websocket is a small server-side implementation of the WebSocket protocol (RFC 6455)
+// covering what the push endpoints need: the opening handshake, text messages, ping/pong and
+// the closing handshake. Extensions and subprotocols are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Çerçeve türleri
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxControlPayload, kontrol çerçevelerinin taşıyabileceği en büyük yük (RFC 6455, 5.5)
+const maxControlPayload = 125
+
+// acceptGUID, Sec-WebSocket-Accept hesaplamasında kullanılan sabit (RFC 6455, 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize, istemciden kabul edilen en büyük mesaj
+var MaxMessageSize = 64 * 1024
+
+var (
+	ErrClosed          = errors.New("WebSocket connection closed")
+	ErrMessageTooLarge = errors.New("WebSocket message too large")
+	ErrProtocol        = errors.New("WebSocket protocol error")
+)
+
+// Conn, el sıkışması tamamlanmış bir WebSocket bağlantısı
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// ReadTimeout, sıfırdan büyükse her çerçeve için beklenecek en uzun süre; pong yanıtları da süreyi uzatır
+	ReadTimeout time.Duration
+
+	// WriteTimeout, sıfırdan büyükse her çerçevenin yazılması için verilen süre. Pong ve kapanış
+	// yanıtları dahil her yazma kendi süresini alır.
+	WriteTimeout time.Duration
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// headerContains reports whether a comma separated header has token, ignoring case
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade performs the opening handshake and takes over the HTTP connection. On failure an
+// HTTP error has already been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, ErrProtocol
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, ErrProtocol
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrProtocol
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket is not supported by this server", http.StatusInternalServerError)
+		return nil, ErrProtocol
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Hijack öncesinde tamponlanmış baytlar kaybolmasın diye okuyucu korunur
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// readFrame reads one frame and unmasks its payload
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	if header[0]&0x70 != 0 || !masked {
+		// Uzantı bitleri anlaşılmadı; istemci çerçeveleri maskelenmek zorunda
+		err = ErrProtocol
+		return
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(MaxMessageSize) {
+		err = ErrMessageTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered and a close frame
+// is acknowledged, after which ErrClosed is returned.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		if c.ReadTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+		}
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, c.fail(err)
+		}
+		// Kontrol çerçeveleri parçalanamaz ve en fazla 125 bayt taşır
+		if opcode&0x8 != 0 && (!fin || len(payload) > maxControlPayload) {
+			return nil, c.fail(ErrProtocol)
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeClose(1000)
+			return nil, ErrClosed
+		case opText, opBinary:
+			if started {
+				return nil, c.fail(ErrProtocol)
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, c.fail(ErrProtocol)
+			}
+		default:
+			return nil, c.fail(ErrProtocol)
+		}
+
+		message = append(message, payload...)
+		if len(message) > MaxMessageSize {
+			return nil, c.fail(ErrMessageTooLarge)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// fail sends the close frame matching a read error and returns the error
+func (c *Conn) fail(err error) error {
+	switch err {
+	case ErrProtocol:
+		c.writeClose(1002)
+	case ErrMessageTooLarge:
+		c.writeClose(1009)
+	}
+	return err
+}
+
+// writeFrame writes a single unmasked frame
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	header := []byte{0x80 | opcode, 0}
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+
+	// Sunucunun WriteTimeout'u ya da önceki yazmanın süresi bu çerçeveye kalmasın
+	deadline := time.Time{}
+	if c.WriteTimeout > 0 {
+		deadline = time.Now().Add(c.WriteTimeout)
+	}
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	if opcode == opClose {
+		c.closed = true
+	}
+	return nil
+}
+
+// writeClose sends a close frame with a status code
+func (c *Conn) writeClose(code uint16) error {
+	return c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// WriteText sends a text message; it is safe to call from several goroutines
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping frame to keep the connection alive
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a normal close frame if none was sent and closes the connection
+func (c *Conn) Close() error {
+	c.writeClose(1000)
+	return c.conn.Close()
+}
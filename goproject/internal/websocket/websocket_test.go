@@ -0,0 +1,342 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient, sunucuya çerçeveleri elle yazan en basit istemci
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial opens a connection to the test server and performs the opening handshake with the
+// sample key from RFC 6455
+func dial(t *testing.T, server *httptest.Server) (*testClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET / HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{conn: conn, reader: reader}, resp
+}
+
+// writeFrame sends a masked client frame
+func (c *testClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads an unmasked server frame
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if header[1]&0x80 != 0 {
+		t.Fatal("server frame is masked")
+	}
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// expectClose reads a close frame and checks its status code
+func (c *testClient) expectClose(t *testing.T, code uint16) {
+	t.Helper()
+	opcode, payload := c.readFrame(t)
+	if opcode != opClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != code {
+		t.Fatalf("got opcode %x payload %v, want close %d", opcode, payload, code)
+	}
+}
+
+// echoServer upgrades every request and echoes text messages back. Read errors are sent to errs.
+func echoServer(t *testing.T, writeTimeout time.Duration, errs chan<- error) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteTimeout = writeTimeout
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				if errs != nil {
+					errs <- err
+				}
+				return
+			}
+			if err := conn.WriteText(message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHandshake(t *testing.T) {
+	_, resp := dial(t, echoServer(t, 0, nil))
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	// RFC 6455, 1.3'teki örnek anahtarın beklenen yanıtı
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		t.Fatalf("Upgrade = %q", resp.Header.Get("Upgrade"))
+	}
+}
+
+func TestHandshakeRejectsPlainRequests(t *testing.T) {
+	server := echoServer(t, 0, nil)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("status = %d, want 426", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "short")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestMaskedTextMessage(t *testing.T) {
+	client, _ := dial(t, echoServer(t, 0, nil))
+
+	client.writeFrame(t, true, opText, []byte("hello"))
+	opcode, payload := client.readFrame(t)
+	if opcode != opText || string(payload) != "hello" {
+		t.Fatalf("got opcode %x payload %q", opcode, payload)
+	}
+
+	// 16 bitlik uzunluk alanı kullanan mesaj
+	long := bytes.Repeat([]byte("x"), 1000)
+	client.writeFrame(t, true, opText, long)
+	if _, payload := client.readFrame(t); !bytes.Equal(payload, long) {
+		t.Fatalf("long message echoed with %d bytes", len(payload))
+	}
+}
+
+func TestFragmentedMessage(t *testing.T) {
+	client, _ := dial(t, echoServer(t, 0, nil))
+
+	client.writeFrame(t, false, opText, []byte("hel"))
+	// Parçalar arasında gelen kontrol çerçevesi mesajı bölmez
+	client.writeFrame(t, true, opPing, []byte("p"))
+	client.writeFrame(t, false, opContinuation, []byte("lo "))
+	client.writeFrame(t, true, opContinuation, []byte("world"))
+
+	opcode, payload := client.readFrame(t)
+	if opcode != opPong || string(payload) != "p" {
+		t.Fatalf("got opcode %x payload %q, want pong", opcode, payload)
+	}
+	opcode, payload = client.readFrame(t)
+	if opcode != opText || string(payload) != "hello world" {
+		t.Fatalf("got opcode %x payload %q", opcode, payload)
+	}
+}
+
+func TestContinuationWithoutStart(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.writeFrame(t, true, opContinuation, []byte("x"))
+	client.expectClose(t, 1002)
+	if err := <-errs; err != ErrProtocol {
+		t.Fatalf("err = %v, want ErrProtocol", err)
+	}
+}
+
+func TestFragmentedControlFrame(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.writeFrame(t, false, opPing, []byte("x"))
+	client.expectClose(t, 1002)
+	if err := <-errs; err != ErrProtocol {
+		t.Fatalf("err = %v, want ErrProtocol", err)
+	}
+}
+
+func TestControlFrameTooLarge(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.writeFrame(t, true, opPing, bytes.Repeat([]byte("x"), maxControlPayload+1))
+	client.expectClose(t, 1002)
+	if err := <-errs; err != ErrProtocol {
+		t.Fatalf("err = %v, want ErrProtocol", err)
+	}
+}
+
+func TestUnmaskedFrameIsRejected(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.conn.Write([]byte{0x80 | opText, 2, 'h', 'i'})
+	client.expectClose(t, 1002)
+	if err := <-errs; err != ErrProtocol {
+		t.Fatalf("err = %v, want ErrProtocol", err)
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.writeFrame(t, true, opText, make([]byte, MaxMessageSize+1))
+	client.expectClose(t, 1009)
+	if err := <-errs; err != ErrMessageTooLarge {
+		t.Fatalf("err = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestFragmentsTooLarge(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	half := make([]byte, MaxMessageSize/2+1)
+	client.writeFrame(t, false, opText, half)
+	client.writeFrame(t, true, opContinuation, half)
+	client.expectClose(t, 1009)
+	if err := <-errs; err != ErrMessageTooLarge {
+		t.Fatalf("err = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	errs := make(chan error, 1)
+	client, _ := dial(t, echoServer(t, 0, errs))
+
+	client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, 1000))
+	client.expectClose(t, 1000)
+	if err := <-errs; err != ErrClosed {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+}
+
+// A ping arriving long after the last server write must still be answered: every frame gets a
+// fresh write deadline instead of inheriting an expired one.
+func TestPongAfterIdle(t *testing.T) {
+	client, _ := dial(t, echoServer(t, 100*time.Millisecond, nil))
+
+	client.writeFrame(t, true, opText, []byte("first"))
+	client.readFrame(t)
+
+	time.Sleep(300 * time.Millisecond)
+	client.writeFrame(t, true, opPing, []byte("still there?"))
+	opcode, payload := client.readFrame(t)
+	if opcode != opPong || string(payload) != "still there?" {
+		t.Fatalf("got opcode %x payload %q, want pong", opcode, payload)
+	}
+}
+
+// The hijacked connection keeps the server's WriteTimeout deadline; it must not apply to frames.
+func TestServerWriteTimeoutIsCleared(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteText(message)
+		}
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	client, _ := dial(t, server)
+	time.Sleep(300 * time.Millisecond)
+	client.writeFrame(t, true, opText, []byte("late"))
+	if opcode, payload := client.readFrame(t); opcode != opText || string(payload) != "late" {
+		t.Fatalf("got opcode %x payload %q", opcode, payload)
+	}
+}